@@ -0,0 +1,273 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Command cumulativetodelta converts OTLP metrics from cumulative to delta
+// the way the processor does, for debugging conversions offline.
+//
+//	cumulativetodelta [flags] [file ...]
+//
+// JSON input holds one ExportMetricsServiceRequest per line, or several
+// concatenated ones. Protobuf input holds one request per file. Without
+// files, the request is read from standard input.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/collector/config/configparser"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/a-feld/cumulativetodeltaprocessor"
+)
+
+const (
+	formatJSON  = "json"
+	formatProto = "proto"
+)
+
+func main() {
+	if err := run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) error {
+	flags := flag.NewFlagSet("cumulativetodelta", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	configFile := flags.String("config", "", "YAML file with the processor configuration")
+	format := flags.String("format", formatJSON, "format of the input: json or proto")
+	outputFile := flags.String("output", "", "file the deltas are written to (default stdout)")
+	outputFormat := flags.String("output-format", formatJSON, "format of the output: json, one request per input request, or proto, a single request")
+	reportFile := flags.String("report", "", "file the summary report is written to (default stderr)")
+	loadState := flags.String("load-state", "", "file to load the tracker state from before converting")
+	saveState := flags.String("save-state", "", "file to save the tracker state to after converting")
+	if err := flags.Parse(args); err == flag.ErrHelp {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, f := range []string{*format, *outputFormat} {
+		if f != formatJSON && f != formatProto {
+			return fmt.Errorf("invalid format %q", f)
+		}
+	}
+
+	cfg, err := loadConfig(*configFile)
+	if err != nil {
+		return err
+	}
+
+	var batches []pdata.Metrics
+	if flags.NArg() == 0 {
+		if batches, err = readBatches(stdin, *format); err != nil {
+			return err
+		}
+	}
+	for _, name := range flags.Args() {
+		f, err := os.Open(name)
+		if err != nil {
+			return err
+		}
+		read, err := readBatches(f, *format)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", name, err)
+		}
+		batches = append(batches, read...)
+	}
+
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig()),
+		zapcore.AddSync(stderr),
+		zapcore.InfoLevel))
+	// The report is read from the telemetry of the processor
+	if err := view.Register(cumulativetodeltaprocessor.MetricViews()...); err != nil {
+		return err
+	}
+	background := new(consumertest.MetricsSink)
+	converter := cumulativetodeltaprocessor.NewConverter(cfg, logger, background)
+
+	if *saveState != "" {
+		if err := converter.CheckSaveState(); err != nil {
+			return fmt.Errorf("saving state: %w", err)
+		}
+	}
+	if *loadState != "" {
+		if err := readFile(*loadState, converter.LoadState); err != nil {
+			return fmt.Errorf("loading state: %w", err)
+		}
+	}
+
+	r := report{batches: len(batches)}
+	var converted []pdata.Metrics
+	// Deltas emitted in the background follow the batch converted before
+	var emitted int
+	takeBackground := func() {
+		all := background.AllMetrics()
+		converted = append(converted, all[emitted:]...)
+		emitted = len(all)
+	}
+	for _, md := range batches {
+		r.pointsIn += md.DataPointCount()
+		converted = append(converted, converter.Convert(md))
+		takeBackground()
+	}
+	r.series = converter.Series()
+	if err := converter.Close(); err != nil {
+		return err
+	}
+	takeBackground()
+	for _, md := range converted {
+		r.pointsOut += md.DataPointCount()
+	}
+
+	if *saveState != "" {
+		if err := writeFile(*saveState, converter.SaveState); err != nil {
+			return fmt.Errorf("saving state: %w", err)
+		}
+	}
+
+	writeOutput := func(w io.Writer) error {
+		return writeBatches(w, converted, *outputFormat)
+	}
+	if *outputFile == "" {
+		err = writeOutput(stdout)
+	} else {
+		err = writeFile(*outputFile, writeOutput)
+	}
+	if err != nil {
+		return err
+	}
+
+	if *reportFile == "" {
+		return r.write(stderr, cfg)
+	}
+	return writeFile(*reportFile, func(w io.Writer) error {
+		return r.write(w, cfg)
+	})
+}
+
+// loadConfig returns the default processor configuration, overridden by
+// the YAML file name when set.
+func loadConfig(name string) (*cumulativetodeltaprocessor.Config, error) {
+	cfg := cumulativetodeltaprocessor.NewFactory().CreateDefaultConfig().(*cumulativetodeltaprocessor.Config)
+	if name != "" {
+		parser, err := configparser.NewParserFromFile(name)
+		if err != nil {
+			return nil, err
+		}
+		if err := parser.UnmarshalExact(cfg); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %w", err)
+	}
+	return cfg, nil
+}
+
+// readBatches reads the requests in r.
+func readBatches(r io.Reader, format string) ([]pdata.Metrics, error) {
+	if format == formatProto {
+		buf, err := ioutil.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		md, err := otlp.NewProtobufMetricsUnmarshaler().UnmarshalMetrics(buf)
+		if err != nil {
+			return nil, err
+		}
+		return []pdata.Metrics{md}, nil
+	}
+
+	var batches []pdata.Metrics
+	unmarshaler := otlp.NewJSONMetricsUnmarshaler()
+	dec := json.NewDecoder(r)
+	for {
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err == io.EOF {
+			return batches, nil
+		} else if err != nil {
+			return nil, err
+		}
+		md, err := unmarshaler.UnmarshalMetrics(raw)
+		if err != nil {
+			return nil, fmt.Errorf("request %d: %w", len(batches)+1, err)
+		}
+		batches = append(batches, md)
+	}
+}
+
+// writeBatches writes JSON batches one per line, and protobuf batches
+// merged into a single request.
+func writeBatches(w io.Writer, batches []pdata.Metrics, format string) error {
+	if format == formatProto {
+		merged := pdata.NewMetrics()
+		for _, md := range batches {
+			md.ResourceMetrics().MoveAndAppendTo(merged.ResourceMetrics())
+		}
+		buf, err := otlp.NewProtobufMetricsMarshaler().MarshalMetrics(merged)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(buf)
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	marshaler := otlp.NewJSONMetricsMarshaler()
+	for _, md := range batches {
+		buf, err := marshaler.MarshalMetrics(md)
+		if err != nil {
+			return err
+		}
+		bw.Write(bytes.TrimSpace(buf))
+		bw.WriteByte('\n')
+	}
+	return bw.Flush()
+}
+
+func readFile(name string, fn func(io.Reader) error) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return fn(f)
+}
+
+func writeFile(name string, fn func(io.Writer) error) error {
+	f, err := os.Create(name)
+	if err != nil {
+		return err
+	}
+	if err := fn(f); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
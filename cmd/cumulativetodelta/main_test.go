@@ -0,0 +1,143 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+func cumulativeRequest(t *testing.T, timestamp pdata.Timestamp, value int64) []byte {
+	md := pdata.NewMetrics()
+	m := md.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("requests")
+	m.SetDataType(pdata.MetricDataTypeSum)
+	m.Sum().SetIsMonotonic(true)
+	m.Sum().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+	dp := m.Sum().DataPoints().AppendEmpty()
+	dp.Attributes().InsertString("host", "a")
+	dp.SetStartTimestamp(1)
+	dp.SetTimestamp(timestamp)
+	dp.SetIntVal(value)
+	buf, err := otlp.NewJSONMetricsMarshaler().MarshalMetrics(md)
+	require.NoError(t, err)
+	return buf
+}
+
+// deltas returns the values of the points in the JSON requests of out.
+func deltas(t *testing.T, out string) []int64 {
+	batches, err := readBatches(strings.NewReader(out), formatJSON)
+	require.NoError(t, err)
+	var values []int64
+	for _, md := range batches {
+		rms := md.ResourceMetrics()
+		for i := 0; i < rms.Len(); i++ {
+			ms := rms.At(i).InstrumentationLibraryMetrics().At(0).Metrics()
+			for j := 0; j < ms.Len(); j++ {
+				dps := ms.At(j).Sum().DataPoints()
+				for k := 0; k < dps.Len(); k++ {
+					values = append(values, dps.At(k).IntVal())
+				}
+			}
+		}
+	}
+	return values
+}
+
+func TestRun(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cumulativetodelta")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	state := filepath.Join(dir, "state.json")
+	config := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(config, []byte("drop_empty: none\n"), 0600))
+
+	var in bytes.Buffer
+	in.Write(cumulativeRequest(t, 10, 100))
+	in.WriteByte('\n')
+	in.Write(cumulativeRequest(t, 20, 150))
+	in.WriteByte('\n')
+	in.Write(cumulativeRequest(t, 30, 20))
+
+	var out, report bytes.Buffer
+	require.NoError(t, run([]string{"-config", config, "-save-state", state}, &in, &out, &report))
+	assert.Equal(t, []int64{100, 50, 20}, deltas(t, out.String()))
+	assert.Contains(t, report.String(), "batches:")
+	assert.Contains(t, report.String(), "counter_reset:")
+
+	// The next run continues from the saved state
+	input := filepath.Join(dir, "input.json")
+	require.NoError(t, ioutil.WriteFile(input, cumulativeRequest(t, 40, 35), 0600))
+	out.Reset()
+	require.NoError(t, run([]string{"-load-state", state, input}, nil, &out, ioutil.Discard))
+	assert.Equal(t, []int64{15}, deltas(t, out.String()))
+}
+
+func TestRun_BackgroundOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cumulativetodelta")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(config, []byte("align_interval: 5ns\n"), 0600))
+
+	var in bytes.Buffer
+	in.Write(cumulativeRequest(t, 10, 100))
+	in.WriteByte('\n')
+	in.Write(cumulativeRequest(t, 20, 150))
+
+	// The earlier bucket of each delta follows the request of its point
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"-config", config}, &in, &out, ioutil.Discard))
+	assert.Equal(t, []int64{56, 44, 25, 25}, deltas(t, out.String()))
+
+	// Aligned buckets carried over aren't saved
+	err = run([]string{"-config", config, "-save-state", filepath.Join(dir, "state.json")}, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	assert.EqualError(t, err, "saving state: the state kept with align_interval can't be saved")
+}
+
+func TestRun_Proto(t *testing.T) {
+	md, err := otlp.NewJSONMetricsUnmarshaler().UnmarshalMetrics(cumulativeRequest(t, 10, 100))
+	require.NoError(t, err)
+	in, err := otlp.NewProtobufMetricsMarshaler().MarshalMetrics(md)
+	require.NoError(t, err)
+
+	var out bytes.Buffer
+	require.NoError(t, run([]string{"-format", "proto", "-output-format", "proto"}, bytes.NewReader(in), &out, ioutil.Discard))
+	got, err := otlp.NewProtobufMetricsUnmarshaler().UnmarshalMetrics(out.Bytes())
+	require.NoError(t, err)
+	assert.Equal(t, 1, got.DataPointCount())
+	m := got.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+	assert.Equal(t, pdata.AggregationTemporalityDelta, m.Sum().AggregationTemporality())
+}
+
+func TestRun_InvalidConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cumulativetodelta")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	config := filepath.Join(dir, "config.yaml")
+	require.NoError(t, ioutil.WriteFile(config, []byte("mode: dry_run\n"), 0600))
+
+	err = run([]string{"-config", config}, strings.NewReader(""), ioutil.Discard, ioutil.Discard)
+	assert.EqualError(t, err, `invalid configuration: invalid mode "dry_run"`)
+}
@@ -0,0 +1,104 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+
+	"go.opencensus.io/stats/view"
+
+	"github.com/a-feld/cumulativetodeltaprocessor"
+)
+
+// report summarizes a conversion.
+type report struct {
+	batches   int
+	pointsIn  int
+	pointsOut int
+	series    int
+}
+
+// write writes the summary, completed with the counts recorded in the
+// telemetry of the processor configured by cfg.
+func (r report) write(w io.Writer, cfg *cumulativetodeltaprocessor.Config) error {
+	telemetry, events, err := readTelemetry(cfg.ID().String())
+	if err != nil {
+		return err
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(tw, "batches:\t%d\n", r.batches)
+	fmt.Fprintf(tw, "points in:\t%d\n", r.pointsIn)
+	fmt.Fprintf(tw, "points out:\t%d\n", r.pointsOut)
+	fmt.Fprintf(tw, "points converted:\t%d\n", telemetry["points_converted"])
+	fmt.Fprintf(tw, "points dropped:\t%d\n", telemetry["points_dropped"])
+	fmt.Fprintf(tw, "points deferred:\t%d\n", telemetry["points_deferred"])
+	fmt.Fprintf(tw, "points to gauge:\t%d\n", telemetry["points_gauge"])
+	fmt.Fprintf(tw, "deltas emitted:\t%d\n", telemetry["delta_value"])
+	fmt.Fprintf(tw, "series tracked:\t%d\n", r.series)
+	names := make([]string, 0, len(events))
+	for name := range events {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(tw, "%s:\t%d\n", name, events[name])
+	}
+	return tw.Flush()
+}
+
+// readTelemetry returns the counts recorded by the processor, by measure
+// and by event.
+func readTelemetry(processor string) (map[string]int64, map[string]int64, error) {
+	counts := make(map[string]int64)
+	events := make(map[string]int64)
+	for _, v := range cumulativetodeltaprocessor.MetricViews() {
+		rows, err := view.RetrieveData(v.Name)
+		if err != nil {
+			return nil, nil, err
+		}
+		for _, row := range rows {
+			var processorTag, eventTag string
+			for _, t := range row.Tags {
+				switch t.Key.Name() {
+				case "processor":
+					processorTag = t.Value
+				case "event":
+					eventTag = t.Value
+				}
+			}
+			if processorTag != processor {
+				continue
+			}
+
+			var count int64
+			switch data := row.Data.(type) {
+			case *view.SumData:
+				count = int64(data.Value)
+			case *view.DistributionData:
+				count = data.Count
+			}
+			if eventTag != "" {
+				events[eventTag] += count
+			} else {
+				counts[v.Measure.Name()] += count
+			}
+		}
+	}
+	return counts, events, nil
+}
@@ -15,9 +15,90 @@
 package cumulativetodeltaprocessor
 
 import (
+	"errors"
+	"fmt"
 	"time"
 
 	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/config/confignet"
+	"go.uber.org/zap/zapcore"
+
+	"github.com/a-feld/cumulativetodeltaprocessor/tracking"
+)
+
+// Levels of the metrics hierarchy which are removed once empty after conversion.
+const (
+	dropEmptyNone      = "none"
+	dropEmptyMetrics   = "metrics"
+	dropEmptyLibraries = "libraries"
+	dropEmptyResources = "resources"
+)
+
+// Clocks the staleness of series can be measured with.
+const (
+	stalenessClockPointTime   = "point_time"
+	stalenessClockReceiveTime = "receive_time"
+)
+
+// How the first delta of a series without a source start timestamp is handled.
+const (
+	missingStartProcessorStart = "processor_start"
+	missingStartDrop           = "drop"
+)
+
+// Actions on the delta across a gap longer than max_gap.
+const (
+	gapActionDrop   = "drop"
+	gapActionEmit   = "emit"
+	gapActionSpread = "spread"
+)
+
+// Actions on implausibly large deltas.
+const (
+	outlierActionDrop  = "drop"
+	outlierActionClamp = "clamp"
+	outlierActionFlag  = "flag"
+)
+
+// Outputs of converted non monotonic sums.
+const (
+	nonMonotonicOutputDelta       = "delta"
+	nonMonotonicOutputGauge       = "gauge"
+	nonMonotonicOutputPassthrough = "passthrough"
+)
+
+// Uses of the OpenMetrics _created series of counters.
+const (
+	createdSeriesIgnore     = "ignore"
+	createdSeriesUse        = "use"
+	createdSeriesUseAndDrop = "use_and_drop"
+)
+
+// Handling of sums with unspecified aggregation temporality.
+const (
+	unspecifiedTemporalityIgnore     = "ignore"
+	unspecifiedTemporalityCumulative = "cumulative"
+	unspecifiedTemporalityInfer      = "infer"
+)
+
+// Modes the processor runs in.
+const (
+	modeConvert = "convert"
+	modeShadow  = "shadow"
+)
+
+// Widths at which unsigned counters wrap around.
+const (
+	wraparoundNone = "none"
+	wraparound32   = "32bit"
+	wraparound64   = "64bit"
+)
+
+// Actions taken on points whose delta overflows or is infinite.
+const (
+	invalidValuesDrop  = "drop"
+	invalidValuesFlag  = "flag"
+	invalidValuesReset = "reset"
 )
 
 // Config defines the configuration for the processor.
@@ -27,16 +108,278 @@ type Config struct {
 	// List of cumulative metrics to convert to delta. Default: converts all cumulative metrics to delta.
 	Metrics []string `mapstructure:"metrics"`
 
+	// "convert" replaces cumulative points with deltas, "shadow" tracks and converts them without changing the data,
+	// only recording the results as telemetry. Default: convert.
+	Mode string `mapstructure:"mode"`
+
 	// The total time a state entry will live past the time it was last seen. Set to 0 to retain state indefinitely.
 	MaxStale time.Duration `mapstructure:"max_stale"`
 
+	// How often stale state is removed and heartbeats are emitted. Defaults to heartbeat_interval when set, otherwise
+	// to max_stale.
+	SweepInterval time.Duration `mapstructure:"sweep_interval"`
+
+	// Clock the time a series was last seen is measured with: "point_time" uses the timestamp reported by the source,
+	// "receive_time" the local time the point was received at. Default: point_time.
+	StalenessClock string `mapstructure:"staleness_clock"`
+
 	// Set to false in order to convert non monotonic metrics
 	MonotonicOnly bool `mapstructure:"monotonic_only"`
+
+	// What non monotonic sums become when monotonic_only is false: "delta" sums, "gauge" with their current
+	// value, or "passthrough" to leave them unchanged. Default: delta.
+	NonMonotonicOutput string `mapstructure:"non_monotonic_output"`
+
+	// Number of points the monotonicity of each series is inferred from, instead of trusting the monotonicity
+	// declared by its producer. Set to 0 to disable inference.
+	InferMonotonicity int `mapstructure:"infer_monotonicity"`
+
+	// Start of the first delta of a monotonic series whose points have no start timestamp before their own:
+	// "processor_start" starts it when the processor started, "drop" drops it. Default: processor_start.
+	MissingStart string `mapstructure:"missing_start"`
+
+	// Use of the OpenMetrics <name>_created gauges of counters in the same resource: "ignore" them, "use" their value
+	// as the start timestamp of the counter, or "use_and_drop" to also remove the points used. Default: ignore.
+	CreatedSeries string `mapstructure:"created_series"`
+
+	// Set to true to convert the points of a series within a batch in timestamp order, wherever they are in the batch.
+	SortPoints bool `mapstructure:"sort_points"`
+
+	// Longest time between two points of a series whose delta is converted as usual. Set to 0 to disable the check.
+	MaxGap time.Duration `mapstructure:"max_gap"`
+
+	// Action on the delta across a longer gap: "drop" to restart the series from the point, "emit" to send it
+	// starting at the previous point, or "spread" to split it evenly into deltas covering at most max_gap each, or
+	// into 1000 deltas when it takes more.
+	// Default: drop.
+	GapAction string `mapstructure:"gap_action"`
+
+	// Interval after which a zero valued delta is emitted for series which have not been seen. Requires max_stale to be set.
+	// Set to 0 to disable heartbeats.
+	HeartbeatInterval time.Duration `mapstructure:"heartbeat_interval"`
+
+	// Interval at which deltas accumulated per series are sent as a single delta. Set to 0 to send a delta for every
+	// incoming point.
+	FlushInterval time.Duration `mapstructure:"flush_interval"`
+
+	// Width of the buckets, aligned to the epoch, each delta is split across proportionally, sending deltas starting
+	// and ending at bucket edges. Set to 0 to send deltas as they are.
+	AlignInterval time.Duration `mapstructure:"align_interval"`
+
+	// Windows the deltas of each series are added up over, sending the total of the current window so far as a
+	// cumulative point starting at the window start instead of each delta. Disabled when not set.
+	Window *WindowConfig `mapstructure:"window"`
+
+	// Up to which level empty metrics, instrumentation libraries and resources are removed after conversion. One of
+	// "none", "metrics", "libraries" or "resources". Default: resources.
+	DropEmpty string `mapstructure:"drop_empty"`
+
+	// Endpoint serving the tracked series state under /debug/cumulativetodelta/series, on localhost when it has no
+	// host. Disabled when not set.
+	Debug *confignet.TCPAddr `mapstructure:"debug"`
+
+	// Logging of counter resets and wraparounds, out of order points, dropped first observations and skipped NaN values.
+	Logging LoggingConfig `mapstructure:"logging"`
+
+	// Settings applying to specific metrics. When several rules list a metric, the first one applies.
+	Rules []RuleConfig `mapstructure:"rules"`
+}
+
+// RuleConfig defines how the metrics it lists are converted.
+type RuleConfig struct {
+	// Names of the metrics the rule applies to.
+	Metrics []string `mapstructure:"metrics"`
+
+	// Width at which the counters wrap around to zero: "none", "32bit" or "64bit". Default: none.
+	Wraparound string `mapstructure:"wraparound"`
+
+	// Action on a point whose delta overflows or which is infinite: "drop", "flag" to pass the delta on
+	// with a cumulativetodelta.flag attribute, or "reset" to start the series anew. Default: drop.
+	InvalidValues string `mapstructure:"invalid_values"`
+
+	// Overrides max_gap for the metrics of the rule.
+	MaxGap time.Duration `mapstructure:"max_gap"`
+
+	// Overrides gap_action for the metrics of the rule.
+	GapAction string `mapstructure:"gap_action"`
+
+	// Largest magnitude of a plausible delta. Set to 0 to disable the check.
+	MaxDelta float64 `mapstructure:"max_delta"`
+
+	// How many times larger than the average recent delta of its series a plausible delta can be. Set to 0 to
+	// disable the check.
+	MaxDeltaFactor float64 `mapstructure:"max_delta_factor"`
+
+	// Action on implausible deltas: "drop", "clamp" to the largest plausible delta, or "flag" to pass them on
+	// with a cumulativetodelta.flag attribute. Default: drop.
+	OutlierAction string `mapstructure:"outlier_action"`
+
+	// Handling of sums with unspecified aggregation temporality: "ignore" them, convert them as "cumulative", or
+	// "infer" whether each series is cumulative from its points. Default: ignore.
+	UnspecifiedTemporality string `mapstructure:"unspecified_temporality"`
+}
+
+// WindowConfig defines the windows deltas are added up over. Exactly one of interval and schedule is set.
+type WindowConfig struct {
+	// Length of the windows, aligned to midnight in the time zone.
+	Interval time.Duration `mapstructure:"interval"`
+
+	// Cron expression of the times windows start at, such as "0 0 * * 1" for weekly windows starting on Monday.
+	Schedule string `mapstructure:"schedule"`
+
+	// Name of the time zone the windows are aligned in, such as "Europe/Berlin". Default: UTC.
+	TimeZone string `mapstructure:"time_zone"`
+}
+
+// windows returns the windows described by the configuration.
+func (cfg *WindowConfig) windows() (tracking.Windows, error) {
+	location, err := time.LoadLocation(cfg.TimeZone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid window time_zone %q", cfg.TimeZone)
+	}
+	switch {
+	case cfg.Interval > 0 && cfg.Schedule == "":
+		return tracking.IntervalWindows{Interval: cfg.Interval, Location: location}, nil
+	case cfg.Interval == 0 && cfg.Schedule != "":
+		return tracking.ParseSchedule(cfg.Schedule, location)
+	}
+	return nil, errors.New("window requires either a positive interval or a schedule")
+}
+
+// LoggingConfig defines how conversion events are logged.
+type LoggingConfig struct {
+	// Set to true to log conversion events.
+	Enabled bool `mapstructure:"enabled"`
+
+	// Level at which events are logged. Default: info.
+	Level string `mapstructure:"level"`
+
+	// Number of events with the same message logged in each sampling tick before sampling starts.
+	SamplingInitial int `mapstructure:"sampling_initial"`
+
+	// Once sampling starts, only every nth event with the same message is logged for the rest of the tick.
+	SamplingThereafter int `mapstructure:"sampling_thereafter"`
+
+	// Duration of a sampling tick.
+	SamplingTick time.Duration `mapstructure:"sampling_tick"`
 }
 
 var _ config.Processor = (*Config)(nil)
 
 // Validate checks if the processor configuration is valid
 func (cfg *Config) Validate() error {
+	if cfg.HeartbeatInterval > 0 && cfg.MaxStale <= 0 {
+		return errors.New("heartbeat_interval requires max_stale to be set")
+	}
+	switch cfg.Mode {
+	case "", modeConvert, modeShadow:
+	default:
+		return fmt.Errorf("invalid mode %q", cfg.Mode)
+	}
+	switch cfg.StalenessClock {
+	case "", stalenessClockPointTime, stalenessClockReceiveTime:
+	default:
+		return fmt.Errorf("invalid staleness_clock %q", cfg.StalenessClock)
+	}
+	switch cfg.MissingStart {
+	case "", missingStartProcessorStart, missingStartDrop:
+	default:
+		return fmt.Errorf("invalid missing_start %q", cfg.MissingStart)
+	}
+	switch cfg.CreatedSeries {
+	case "", createdSeriesIgnore, createdSeriesUse, createdSeriesUseAndDrop:
+	default:
+		return fmt.Errorf("invalid created_series %q", cfg.CreatedSeries)
+	}
+	switch cfg.NonMonotonicOutput {
+	case "", nonMonotonicOutputDelta, nonMonotonicOutputGauge, nonMonotonicOutputPassthrough:
+	default:
+		return fmt.Errorf("invalid non_monotonic_output %q", cfg.NonMonotonicOutput)
+	}
+	if cfg.InferMonotonicity < 0 {
+		return errors.New("infer_monotonicity must not be negative")
+	}
+	if !validGapAction(cfg.GapAction) {
+		return fmt.Errorf("invalid gap_action %q", cfg.GapAction)
+	}
+	if cfg.AlignInterval < 0 {
+		return errors.New("align_interval must not be negative")
+	}
+	if cfg.AlignInterval > 0 && (cfg.HeartbeatInterval > 0 || cfg.FlushInterval > 0 || cfg.Window != nil) {
+		return errors.New("align_interval cannot be combined with heartbeat_interval, flush_interval or window")
+	}
+	if cfg.Window != nil {
+		if cfg.HeartbeatInterval > 0 || cfg.FlushInterval > 0 {
+			return errors.New("window cannot be combined with heartbeat_interval or flush_interval")
+		}
+		if _, err := cfg.Window.windows(); err != nil {
+			return err
+		}
+	}
+	// Series passed on as cumulative when inferred non monotonic are
+	// tracked like the others, so they must not be converted in the
+	// background before their monotonicity is known
+	if cfg.InferMonotonicity > 0 && (cfg.MonotonicOnly || cfg.NonMonotonicOutput == nonMonotonicOutputPassthrough) {
+		spread := cfg.GapAction == gapActionSpread
+		for _, rule := range cfg.Rules {
+			spread = spread || rule.GapAction == gapActionSpread
+		}
+		if cfg.HeartbeatInterval > 0 || cfg.FlushInterval > 0 || cfg.AlignInterval > 0 || cfg.Window != nil || spread {
+			return errors.New("infer_monotonicity with monotonic_only cannot be combined with heartbeat_interval, flush_interval, align_interval, window or gap_action spread")
+		}
+	}
+	switch cfg.DropEmpty {
+	case "", dropEmptyNone, dropEmptyMetrics, dropEmptyLibraries, dropEmptyResources:
+	default:
+		return fmt.Errorf("invalid drop_empty %q", cfg.DropEmpty)
+	}
+	for i, rule := range cfg.Rules {
+		if len(rule.Metrics) == 0 {
+			return fmt.Errorf("rule %d lists no metrics", i)
+		}
+		switch rule.Wraparound {
+		case "", wraparoundNone, wraparound32, wraparound64:
+		default:
+			return fmt.Errorf("invalid wraparound %q in rule %d", rule.Wraparound, i)
+		}
+		switch rule.InvalidValues {
+		case "", invalidValuesDrop, invalidValuesFlag, invalidValuesReset:
+		default:
+			return fmt.Errorf("invalid invalid_values %q in rule %d", rule.InvalidValues, i)
+		}
+		if !validGapAction(rule.GapAction) {
+			return fmt.Errorf("invalid gap_action %q in rule %d", rule.GapAction, i)
+		}
+		if rule.MaxDelta < 0 || rule.MaxDeltaFactor < 0 {
+			return fmt.Errorf("negative max_delta or max_delta_factor in rule %d", i)
+		}
+		switch rule.OutlierAction {
+		case "", outlierActionDrop, outlierActionClamp, outlierActionFlag:
+		default:
+			return fmt.Errorf("invalid outlier_action %q in rule %d", rule.OutlierAction, i)
+		}
+		switch rule.UnspecifiedTemporality {
+		case "", unspecifiedTemporalityIgnore, unspecifiedTemporalityCumulative, unspecifiedTemporalityInfer:
+		default:
+			return fmt.Errorf("invalid unspecified_temporality %q in rule %d", rule.UnspecifiedTemporality, i)
+		}
+	}
+	if cfg.Logging.Enabled {
+		var level zapcore.Level
+		if err := level.UnmarshalText([]byte(cfg.Logging.Level)); err != nil {
+			return fmt.Errorf("invalid logging level %q", cfg.Logging.Level)
+		}
+		if cfg.Logging.SamplingTick <= 0 {
+			return errors.New("logging sampling_tick must be positive")
+		}
+	}
 	return nil
 }
+
+func validGapAction(action string) bool {
+	switch action {
+	case "", gapActionDrop, gapActionEmit, gapActionSpread:
+		return true
+	}
+	return false
+}
@@ -23,6 +23,7 @@ import (
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/config/confignet"
 	"go.opentelemetry.io/collector/config/configtest"
 )
 
@@ -49,14 +50,105 @@ func TestLoadingFullConfig(t *testing.T) {
 					"metric1",
 					"metric2",
 				},
-				MaxStale:      10 * time.Second,
-				MonotonicOnly: false,
+				Mode:               "shadow",
+				MaxStale:           10 * time.Second,
+				SweepInterval:      time.Second,
+				StalenessClock:     "receive_time",
+				MonotonicOnly:      false,
+				NonMonotonicOutput: "gauge",
+				InferMonotonicity:  10,
+				MissingStart:       "drop",
+				CreatedSeries:      "use_and_drop",
+				SortPoints:         true,
+				MaxGap:             5 * time.Minute,
+				GapAction:          "spread",
+				HeartbeatInterval:  5 * time.Second,
+				FlushInterval:      60 * time.Second,
+				DropEmpty:          "metrics",
+				Debug: &confignet.TCPAddr{
+					Endpoint: "localhost:55690",
+				},
+				Logging: LoggingConfig{
+					Enabled:            true,
+					Level:              "debug",
+					SamplingInitial:    5,
+					SamplingThereafter: 50,
+					SamplingTick:       10 * time.Second,
+				},
+				Rules: []RuleConfig{
+					{
+						Metrics:                []string{"ifInOctets", "ifOutOctets"},
+						Wraparound:             "32bit",
+						InvalidValues:          "flag",
+						MaxGap:                 time.Hour,
+						GapAction:              "emit",
+						MaxDeltaFactor:         1000,
+						OutlierAction:          "clamp",
+						UnspecifiedTemporality: "infer",
+					},
+				},
 			},
 		},
 		{
 			expCfg: &Config{
-				ProcessorSettings: config.NewProcessorSettings(config.NewID(typeStr)),
-				MonotonicOnly:     true,
+				ProcessorSettings:  config.NewProcessorSettings(config.NewIDWithName(typeStr, "window")),
+				Mode:               "convert",
+				MonotonicOnly:      true,
+				NonMonotonicOutput: "delta",
+				StalenessClock:     "point_time",
+				MissingStart:       "processor_start",
+				CreatedSeries:      "ignore",
+				GapAction:          "drop",
+				Window: &WindowConfig{
+					Schedule: "0 0 * * *",
+					TimeZone: "Europe/Berlin",
+				},
+				DropEmpty: "resources",
+				Logging: LoggingConfig{
+					Level:              "info",
+					SamplingInitial:    10,
+					SamplingThereafter: 100,
+					SamplingTick:       time.Second,
+				},
+			},
+		},
+		{
+			expCfg: &Config{
+				ProcessorSettings:  config.NewProcessorSettings(config.NewIDWithName(typeStr, "aligned")),
+				Mode:               "convert",
+				MonotonicOnly:      true,
+				NonMonotonicOutput: "delta",
+				StalenessClock:     "point_time",
+				MissingStart:       "processor_start",
+				CreatedSeries:      "ignore",
+				GapAction:          "drop",
+				AlignInterval:      time.Minute,
+				DropEmpty:          "resources",
+				Logging: LoggingConfig{
+					Level:              "info",
+					SamplingInitial:    10,
+					SamplingThereafter: 100,
+					SamplingTick:       time.Second,
+				},
+			},
+		},
+		{
+			expCfg: &Config{
+				ProcessorSettings:  config.NewProcessorSettings(config.NewID(typeStr)),
+				Mode:               "convert",
+				MonotonicOnly:      true,
+				NonMonotonicOutput: "delta",
+				StalenessClock:     "point_time",
+				MissingStart:       "processor_start",
+				CreatedSeries:      "ignore",
+				GapAction:          "drop",
+				DropEmpty:          "resources",
+				Logging: LoggingConfig{
+					Level:              "info",
+					SamplingInitial:    10,
+					SamplingThereafter: 100,
+					SamplingTick:       time.Second,
+				},
 			},
 		},
 	}
@@ -68,3 +160,234 @@ func TestLoadingFullConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     *Config
+		wantErr string
+	}{
+		{
+			name: "heartbeat with max_stale",
+			cfg: &Config{
+				MaxStale:          10 * time.Second,
+				HeartbeatInterval: time.Second,
+			},
+		},
+		{
+			name: "heartbeat without max_stale",
+			cfg: &Config{
+				HeartbeatInterval: time.Second,
+			},
+			wantErr: "heartbeat_interval requires max_stale to be set",
+		},
+		{
+			name: "invalid mode",
+			cfg: &Config{
+				Mode: "dry_run",
+			},
+			wantErr: `invalid mode "dry_run"`,
+		},
+		{
+			name: "invalid staleness_clock",
+			cfg: &Config{
+				StalenessClock: "wall_time",
+			},
+			wantErr: `invalid staleness_clock "wall_time"`,
+		},
+		{
+			name: "invalid missing_start",
+			cfg: &Config{
+				MissingStart: "point_time",
+			},
+			wantErr: `invalid missing_start "point_time"`,
+		},
+		{
+			name: "invalid non_monotonic_output",
+			cfg: &Config{
+				NonMonotonicOutput: "cumulative",
+			},
+			wantErr: `invalid non_monotonic_output "cumulative"`,
+		},
+		{
+			name: "negative infer_monotonicity",
+			cfg: &Config{
+				InferMonotonicity: -1,
+			},
+			wantErr: "infer_monotonicity must not be negative",
+		},
+		{
+			name: "invalid gap_action",
+			cfg: &Config{
+				GapAction: "interpolate",
+			},
+			wantErr: `invalid gap_action "interpolate"`,
+		},
+		{
+			name: "invalid gap_action in rule",
+			cfg: &Config{
+				Rules: []RuleConfig{{Metrics: []string{"metric1"}, GapAction: "interpolate"}},
+			},
+			wantErr: `invalid gap_action "interpolate" in rule 0`,
+		},
+		{
+			name: "negative max_delta",
+			cfg: &Config{
+				Rules: []RuleConfig{{Metrics: []string{"metric1"}, MaxDelta: -1}},
+			},
+			wantErr: "negative max_delta or max_delta_factor in rule 0",
+		},
+		{
+			name: "invalid outlier_action",
+			cfg: &Config{
+				Rules: []RuleConfig{{Metrics: []string{"metric1"}, OutlierAction: "ignore"}},
+			},
+			wantErr: `invalid outlier_action "ignore" in rule 0`,
+		},
+		{
+			name: "invalid drop_empty",
+			cfg: &Config{
+				DropEmpty: "points",
+			},
+			wantErr: `invalid drop_empty "points"`,
+		},
+		{
+			name: "rule without metrics",
+			cfg: &Config{
+				Rules: []RuleConfig{{Wraparound: "32bit"}},
+			},
+			wantErr: "rule 0 lists no metrics",
+		},
+		{
+			name: "invalid wraparound",
+			cfg: &Config{
+				Rules: []RuleConfig{
+					{Metrics: []string{"metric1"}, Wraparound: "32bit"},
+					{Metrics: []string{"metric2"}, Wraparound: "16bit"},
+				},
+			},
+			wantErr: `invalid wraparound "16bit" in rule 1`,
+		},
+		{
+			name: "invalid invalid_values",
+			cfg: &Config{
+				Rules: []RuleConfig{{Metrics: []string{"metric1"}, InvalidValues: "clamp"}},
+			},
+			wantErr: `invalid invalid_values "clamp" in rule 0`,
+		},
+		{
+			name: "window with schedule",
+			cfg: &Config{
+				Window: &WindowConfig{Schedule: "0 0 * * *", TimeZone: "Europe/Berlin"},
+			},
+		},
+		{
+			name: "window without interval or schedule",
+			cfg: &Config{
+				Window: &WindowConfig{},
+			},
+			wantErr: "window requires either a positive interval or a schedule",
+		},
+		{
+			name: "window with invalid schedule",
+			cfg: &Config{
+				Window: &WindowConfig{Schedule: "0 24 * * *"},
+			},
+			wantErr: `invalid hour in schedule "0 24 * * *": "24" out of range 0-23`,
+		},
+		{
+			name: "window with invalid time_zone",
+			cfg: &Config{
+				Window: &WindowConfig{Interval: time.Hour, TimeZone: "Mars/Olympus"},
+			},
+			wantErr: `invalid window time_zone "Mars/Olympus"`,
+		},
+		{
+			name: "window with flush_interval",
+			cfg: &Config{
+				FlushInterval: time.Minute,
+				Window:        &WindowConfig{Interval: time.Hour},
+			},
+			wantErr: "window cannot be combined with heartbeat_interval or flush_interval",
+		},
+		{
+			name: "infer_monotonicity with monotonic_only and flush_interval",
+			cfg: &Config{
+				MonotonicOnly:     true,
+				InferMonotonicity: 2,
+				FlushInterval:     time.Minute,
+			},
+			wantErr: "infer_monotonicity with monotonic_only cannot be combined with heartbeat_interval, flush_interval, align_interval, window or gap_action spread",
+		},
+		{
+			name: "infer_monotonicity with passthrough and gap_action spread in a rule",
+			cfg: &Config{
+				NonMonotonicOutput: nonMonotonicOutputPassthrough,
+				InferMonotonicity:  2,
+				Rules:              []RuleConfig{{Metrics: []string{"requests"}, GapAction: gapActionSpread}},
+			},
+			wantErr: "infer_monotonicity with monotonic_only cannot be combined with heartbeat_interval, flush_interval, align_interval, window or gap_action spread",
+		},
+		{
+			name: "negative align_interval",
+			cfg: &Config{
+				AlignInterval: -time.Minute,
+			},
+			wantErr: "align_interval must not be negative",
+		},
+		{
+			name: "align_interval with window",
+			cfg: &Config{
+				AlignInterval: time.Minute,
+				Window:        &WindowConfig{Interval: time.Hour},
+			},
+			wantErr: "align_interval cannot be combined with heartbeat_interval, flush_interval or window",
+		},
+		{
+			name: "invalid created_series",
+			cfg: &Config{
+				CreatedSeries: "drop",
+			},
+			wantErr: `invalid created_series "drop"`,
+		},
+		{
+			name: "invalid unspecified_temporality",
+			cfg: &Config{
+				Rules: []RuleConfig{{Metrics: []string{"metric1"}, UnspecifiedTemporality: "delta"}},
+			},
+			wantErr: `invalid unspecified_temporality "delta" in rule 0`,
+		},
+		{
+			name: "invalid logging level",
+			cfg: &Config{
+				Logging: LoggingConfig{
+					Enabled:      true,
+					Level:        "loud",
+					SamplingTick: time.Second,
+				},
+			},
+			wantErr: `invalid logging level "loud"`,
+		},
+		{
+			name: "logging without sampling tick",
+			cfg: &Config{
+				Logging: LoggingConfig{
+					Enabled: true,
+					Level:   "info",
+				},
+			},
+			wantErr: "logging sampling_tick must be positive",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := test.cfg.Validate()
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.EqualError(t, err, test.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,169 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/a-feld/cumulativetodeltaprocessor/tracking"
+)
+
+// Converter converts metrics from cumulative to delta the way the
+// processor does, outside of a collector pipeline.
+type Converter struct {
+	processor *cumulativeToDeltaProcessor
+	config    *Config
+}
+
+// NewConverter returns a Converter configured by cfg. Deltas emitted in the
+// background, such as heartbeats and flushed aggregates, are sent to next.
+func NewConverter(cfg *Config, logger *zap.Logger, next consumer.Metrics) *Converter {
+	return &Converter{processor: newCumulativeToDeltaProcessor(cfg, logger, next), config: cfg}
+}
+
+// Convert converts the cumulative sums of md and returns the result.
+func (c *Converter) Convert(md pdata.Metrics) pdata.Metrics {
+	md, _ = c.processor.processMetrics(context.Background(), md)
+	return md
+}
+
+// Series returns the number of tracked series.
+func (c *Converter) Series() int {
+	return len(c.processor.deltaCalculator.States())
+}
+
+// Close sends the accumulated deltas and stops the background work.
+func (c *Converter) Close() error {
+	return c.processor.Shutdown(context.Background())
+}
+
+// CheckSaveState returns an error when the configuration keeps more state
+// per series than SaveState saves, which is only the last point of each
+// series.
+func (c *Converter) CheckSaveState() error {
+	cfg := c.config
+	var options []string
+	if cfg.HeartbeatInterval > 0 {
+		options = append(options, "heartbeat_interval")
+	}
+	if cfg.FlushInterval > 0 {
+		options = append(options, "flush_interval")
+	}
+	if cfg.AlignInterval > 0 {
+		options = append(options, "align_interval")
+	}
+	if cfg.Window != nil {
+		options = append(options, "window")
+	}
+	if cfg.InferMonotonicity > 0 {
+		options = append(options, "infer_monotonicity")
+	}
+	if cfg.CreatedSeries != "" && cfg.CreatedSeries != createdSeriesIgnore {
+		options = append(options, "created_series")
+	}
+	for i, rule := range cfg.Rules {
+		if rule.MaxDeltaFactor > 0 {
+			options = append(options, fmt.Sprintf("max_delta_factor in rule %d", i))
+		}
+		if rule.UnspecifiedTemporality == unspecifiedTemporalityInfer {
+			options = append(options, fmt.Sprintf("unspecified_temporality in rule %d", i))
+		}
+	}
+	if len(options) > 0 {
+		return fmt.Errorf("the state kept with %s can't be saved", strings.Join(options, ", "))
+	}
+	return nil
+}
+
+// SaveState writes the last point of every tracked series to w, as
+// cumulative sums in OTLP JSON. It fails when CheckSaveState does.
+func (c *Converter) SaveState(w io.Writer) error {
+	if err := c.CheckSaveState(); err != nil {
+		return err
+	}
+	states := c.processor.deltaCalculator.States()
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Key < states[j].Key
+	})
+	points := make([]tracking.DeltaPoint, 0, len(states))
+	for _, state := range states {
+		p := tracking.DeltaPoint{
+			Identity:  state.Identity,
+			Timestamp: state.PrevPoint.ObservedTimestamp,
+		}
+		p.Value.StartTimestamp = state.Identity.StartTimestamp
+		p.Value.FloatValue = state.PrevPoint.FloatValue
+		p.Value.IntValue = state.PrevPoint.IntValue
+		points = append(points, p)
+	}
+
+	buf, err := otlp.NewJSONMetricsMarshaler().MarshalMetrics(pointsToSums(points, pdata.AggregationTemporalityCumulative))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+// LoadState restores the state of the series saved by SaveState.
+func (c *Converter) LoadState(r io.Reader) error {
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	md, err := otlp.NewJSONMetricsUnmarshaler().UnmarshalMetrics(buf)
+	if err != nil {
+		return err
+	}
+
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		ilms := rm.InstrumentationLibraryMetrics()
+		for j := 0; j < ilms.Len(); j++ {
+			ilm := ilms.At(j)
+			ms := ilm.Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				m := ms.At(k)
+				if m.DataType() != pdata.MetricDataTypeSum {
+					continue
+				}
+				baseIdentity := tracking.MetricIdentity{
+					Resource:               rm.Resource(),
+					InstrumentationLibrary: ilm.InstrumentationLibrary(),
+					MetricDataType:         m.DataType(),
+					MetricIsMonotonic:      m.Sum().IsMonotonic(),
+					MetricName:             m.Name(),
+					MetricUnit:             m.Unit(),
+				}
+				dps := m.Sum().DataPoints()
+				for l := 0; l < dps.Len(); l++ {
+					c.processor.deltaCalculator.Restore(newMetricPoint(baseIdentity, dps.At(l)))
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.uber.org/zap"
+)
+
+func TestConverter_SaveAndLoadState(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	convert := func(c *Converter, value float64) float64 {
+		md := generateTestMetrics(testMetric{
+			metricNames:  []string{"metric_1"},
+			metricValues: [][]float64{{value}},
+			isCumulative: []bool{true},
+		})
+		md.ResourceMetrics().At(0).Resource().Attributes().InsertString("host", "a")
+		got := c.Convert(md)
+		return got.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0).DoubleVal()
+	}
+
+	first := NewConverter(cfg, zap.NewNop(), consumertest.NewNop())
+	assert.Equal(t, 100.0, convert(first, 100))
+	assert.Equal(t, 1, first.Series())
+	require.NoError(t, first.Close())
+	var state bytes.Buffer
+	require.NoError(t, first.SaveState(&state))
+
+	second := NewConverter(cfg, zap.NewNop(), consumertest.NewNop())
+	require.NoError(t, second.LoadState(&state))
+	assert.Equal(t, 1, second.Series())
+	assert.Equal(t, 20.0, convert(second, 120))
+	require.NoError(t, second.Close())
+}
+
+func TestConverter_LoadInvalidState(t *testing.T) {
+	c := NewConverter(createDefaultConfig().(*Config), zap.NewNop(), consumertest.NewNop())
+	defer c.Close()
+	assert.Error(t, c.LoadState(bytes.NewBufferString("not json")))
+	assert.Equal(t, 0, c.Series())
+}
+
+func TestConverter_CheckSaveState(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	c := NewConverter(cfg, zap.NewNop(), consumertest.NewNop())
+	assert.NoError(t, c.CheckSaveState())
+	require.NoError(t, c.Close())
+
+	cfg.HeartbeatInterval = time.Minute
+	cfg.Rules = []RuleConfig{{Metrics: []string{"metric_1"}, MaxDeltaFactor: 10}}
+	c = NewConverter(cfg, zap.NewNop(), consumertest.NewNop())
+	defer c.Close()
+	assert.EqualError(t, c.CheckSaveState(), "the state kept with heartbeat_interval, max_delta_factor in rule 0 can't be saved")
+	assert.Error(t, c.SaveState(&bytes.Buffer{}))
+}
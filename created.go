@@ -0,0 +1,161 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"bytes"
+	"math"
+	"strings"
+
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/a-feld/cumulativetodeltaprocessor/tracking"
+)
+
+// Suffixes of OpenMetrics counter names and of the series reporting when
+// they were created.
+const (
+	totalSuffix   = "_total"
+	createdSuffix = "_created"
+)
+
+// createdTimes holds the times the counters of a resource were created at,
+// as reported by their _created gauges, keyed by key.
+type createdTimes struct {
+	times map[string]pdata.Timestamp
+	// used holds the keys of the times start timestamps were set from.
+	used map[string]bool
+	b    *bytes.Buffer
+}
+
+// newCreatedTimes reads the _created gauges of rm.
+func newCreatedTimes(rm pdata.ResourceMetrics) *createdTimes {
+	c := &createdTimes{b: &bytes.Buffer{}}
+	ilms := rm.InstrumentationLibraryMetrics()
+	for i := 0; i < ilms.Len(); i++ {
+		ms := ilms.At(i).Metrics()
+		for j := 0; j < ms.Len(); j++ {
+			m := ms.At(j)
+			if m.DataType() != pdata.MetricDataTypeGauge || !strings.HasSuffix(m.Name(), createdSuffix) {
+				continue
+			}
+			base := strings.TrimSuffix(m.Name(), createdSuffix)
+			dps := m.Gauge().DataPoints()
+			for k := 0; k < dps.Len(); k++ {
+				dp := dps.At(k)
+				seconds := dp.DoubleVal()
+				if dp.Type() == pdata.MetricValueTypeInt {
+					seconds = float64(dp.IntVal())
+				}
+				if !(seconds > 0) || seconds > math.MaxInt64/1e9 {
+					continue
+				}
+				if c.times == nil {
+					c.times = make(map[string]pdata.Timestamp)
+					c.used = make(map[string]bool)
+				}
+				c.times[c.key(base, dp.Attributes())] = pdata.Timestamp(seconds * 1e9)
+			}
+		}
+	}
+	return c
+}
+
+// key returns the key of the series with the given attributes of the
+// counter, or _created gauge, named base with its suffix removed.
+func (c *createdTimes) key(base string, attrs pdata.AttributeMap) string {
+	c.b.Reset()
+	c.b.WriteString(base)
+	id := tracking.MetricIdentity{
+		Resource:               pdata.NewResource(),
+		InstrumentationLibrary: pdata.NewInstrumentationLibrary(),
+		Attributes:             attrs,
+	}
+	id.Write(c.b)
+	return c.b.String()
+}
+
+// setStart sets the start timestamps of the points of the counter m, with
+// the identity base, from its _created gauge, where it has one created
+// before the point, and remembers it in tracker. Points without a gauge
+// start at the time remembered for their series, if any, so that their
+// series doesn't change with batches lacking the gauge.
+func (c *createdTimes) setStart(tracker tracking.MetricTracker, base tracking.MetricIdentity, m pdata.Metric) {
+	name := strings.TrimSuffix(m.Name(), totalSuffix)
+	dps := m.Sum().DataPoints()
+	for i := 0; i < dps.Len(); i++ {
+		dp := dps.At(i)
+		id := newMetricPoint(base, dp).Identity
+		key := c.key(name, dp.Attributes())
+		created, ok := c.times[key]
+		if ok {
+			tracker.SetStart(id, created, dp.Timestamp())
+		} else {
+			created, ok = tracker.Start(id, dp.Timestamp())
+		}
+		if !ok || created >= dp.Timestamp() {
+			continue
+		}
+		dp.SetStartTimestamp(created)
+		if c.used != nil {
+			c.used[key] = true
+		}
+	}
+}
+
+// removeUsed removes the points of the _created gauges of ms which start
+// timestamps were set from, and the gauges left without points.
+func (c *createdTimes) removeUsed(ms pdata.MetricSlice) {
+	if len(c.used) == 0 {
+		return
+	}
+	ms.RemoveIf(func(m pdata.Metric) bool {
+		if m.DataType() != pdata.MetricDataTypeGauge || !strings.HasSuffix(m.Name(), createdSuffix) {
+			return false
+		}
+		base := strings.TrimSuffix(m.Name(), createdSuffix)
+		dps := m.Gauge().DataPoints()
+		dps.RemoveIf(func(dp pdata.NumberDataPoint) bool {
+			return c.used[c.key(base, dp.Attributes())]
+		})
+		return dps.Len() == 0
+	})
+}
+
+// applyCreatedTimes sets the start timestamps of the points of the
+// cumulative sums of md from the _created gauges of their resource, or
+// from the ones last seen for their series, and removes the gauges used
+// when configured to.
+func (ctdp *cumulativeToDeltaProcessor) applyCreatedTimes(md pdata.Metrics) {
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		c := newCreatedTimes(rm)
+		ilms := rm.InstrumentationLibraryMetrics()
+		for j := 0; j < ilms.Len(); j++ {
+			ms := ilms.At(j).Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				if _, ok := ctdp.cumulativeSum(ms.At(k)); ok {
+					c.setStart(ctdp.deltaCalculator, newBaseIdentity(rm, ilms.At(j), ms.At(k)), ms.At(k))
+				}
+			}
+		}
+		if ctdp.dropCreated {
+			for j := 0; j < ilms.Len(); j++ {
+				c.removeUsed(ilms.At(j).Metrics())
+			}
+		}
+	}
+}
@@ -0,0 +1,220 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	tracetranslator "go.opentelemetry.io/collector/translator/trace"
+
+	"github.com/a-feld/cumulativetodeltaprocessor/tracking"
+)
+
+const debugPathPrefix = "/debug/cumulativetodelta"
+
+// seriesView is the readable form of a tracked series.
+type seriesView struct {
+	Key            string `json:"key"`
+	Resource       string `json:"resource"`
+	Library        string `json:"library"`
+	Metric         string `json:"metric"`
+	Unit           string `json:"unit"`
+	Monotonic      bool   `json:"monotonic"`
+	Inferred       string `json:"inferred,omitempty"`
+	Attributes     string `json:"attributes"`
+	StartTimestamp string `json:"start_timestamp"`
+	PrevValue      string `json:"prev_value"`
+	LastObserved   string `json:"last_observed"`
+	LastSeen       string `json:"last_seen"`
+	Age            string `json:"age"`
+}
+
+var seriesTemplate = template.Must(template.New("series").Parse(`<!DOCTYPE html>
+<html>
+<head><title>cumulativetodelta series</title></head>
+<body>
+<h1>Tracked series ({{len .}})</h1>
+<table border="1" cellpadding="4">
+<tr><th>Metric</th><th>Unit</th><th>Monotonic</th><th>Inferred</th><th>Attributes</th><th>Resource</th><th>Library</th><th>Start</th><th>Previous value</th><th>Last observed</th><th>Last seen</th><th>Age</th><th></th></tr>
+{{range .}}<tr>
+<td>{{.Metric}}</td><td>{{.Unit}}</td><td>{{.Monotonic}}</td><td>{{.Inferred}}</td><td>{{.Attributes}}</td><td>{{.Resource}}</td><td>{{.Library}}</td>
+<td>{{.StartTimestamp}}</td><td>{{.PrevValue}}</td><td>{{.LastObserved}}</td><td>{{.LastSeen}}</td><td>{{.Age}}</td>
+<td><form method="post" action="series/delete?key={{.Key}}"><input type="submit" value="Delete"></form></td>
+</tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// debugHandler serves the state tracked for each series.
+//
+//	GET  series?metric=<name>&attr=<key>=<value>&format=json
+//	POST series/delete?key=<key>
+func (ctdp *cumulativeToDeltaProcessor) debugHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc(debugPathPrefix+"/series", ctdp.handleSeries)
+	mux.HandleFunc(debugPathPrefix+"/series/delete", ctdp.handleDeleteSeries)
+	return mux
+}
+
+func (ctdp *cumulativeToDeltaProcessor) handleSeries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	metric := query.Get("metric")
+	attrs := make(map[string]string)
+	for _, attr := range query["attr"] {
+		kv := strings.SplitN(attr, "=", 2)
+		if len(kv) != 2 {
+			http.Error(w, "attr must be of the form key=value", http.StatusBadRequest)
+			return
+		}
+		attrs[kv[0]] = kv[1]
+	}
+
+	now := time.Now()
+	views := []seriesView{}
+	for _, state := range ctdp.deltaCalculator.States() {
+		id := state.Identity
+		if metric != "" && id.MetricName != metric {
+			continue
+		}
+		if !matchAttributes(id, attrs) {
+			continue
+		}
+		views = append(views, newSeriesView(state, now))
+	}
+	sort.Slice(views, func(i, j int) bool {
+		if views[i].Metric != views[j].Metric {
+			return views[i].Metric < views[j].Metric
+		}
+		return views[i].Attributes < views[j].Attributes
+	})
+
+	if query.Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(views)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_ = seriesTemplate.Execute(w, views)
+}
+
+func (ctdp *cumulativeToDeltaProcessor) handleDeleteSeries(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	// Browsers send the origin of cross-site requests, which mustn't
+	// delete series on behalf of another page
+	if origin := r.Header.Get("Origin"); origin != "" && origin != "http://"+r.Host {
+		http.Error(w, "cross-origin request", http.StatusForbidden)
+		return
+	}
+	key, err := base64.RawURLEncoding.DecodeString(r.URL.Query().Get("key"))
+	if err != nil {
+		http.Error(w, "invalid key", http.StatusBadRequest)
+		return
+	}
+	if !ctdp.deltaCalculator.Remove(string(key)) {
+		http.Error(w, "series not found", http.StatusNotFound)
+		return
+	}
+	if r.Method == http.MethodPost {
+		http.Redirect(w, r, debugPathPrefix+"/series", http.StatusSeeOther)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// debugEndpoint returns endpoint, on localhost when it has no host, as the
+// debug endpoint has no authentication.
+func debugEndpoint(endpoint string) string {
+	host, port, err := net.SplitHostPort(endpoint)
+	if endpoint != "" && (err != nil || host != "") {
+		return endpoint
+	}
+	if port == "" {
+		port = "0"
+	}
+	return net.JoinHostPort("localhost", port)
+}
+
+// matchAttributes reports whether every filter matches either an attribute
+// of the series or of its resource.
+func matchAttributes(id tracking.MetricIdentity, filters map[string]string) bool {
+	for k, want := range filters {
+		v, ok := id.Attributes.Get(k)
+		if !ok {
+			v, ok = id.Resource.Attributes().Get(k)
+		}
+		if !ok || tracetranslator.AttributeValueToString(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+func newSeriesView(state tracking.SeriesState, now time.Time) seriesView {
+	id := state.Identity
+	v := seriesView{
+		Key:          base64.RawURLEncoding.EncodeToString([]byte(state.Key)),
+		Resource:     attributesString(id.Resource.Attributes()),
+		Library:      strings.TrimSuffix(id.InstrumentationLibrary.Name()+" "+id.InstrumentationLibrary.Version(), " "),
+		Metric:       id.MetricName,
+		Unit:         id.MetricUnit,
+		Monotonic:    id.MetricIsMonotonic,
+		Inferred:     state.Inferred.String(),
+		Attributes:   attributesString(id.Attributes),
+		LastObserved: state.PrevPoint.ObservedTimestamp.AsTime().Format(time.RFC3339Nano),
+		LastSeen:     state.LastSeen.AsTime().Format(time.RFC3339Nano),
+		Age:          now.Sub(state.LastSeen.AsTime()).Round(time.Millisecond).String(),
+	}
+	if id.StartTimestamp != 0 {
+		v.StartTimestamp = id.StartTimestamp.AsTime().Format(time.RFC3339Nano)
+	}
+	if id.IsFloatVal() {
+		v.PrevValue = strconv.FormatFloat(state.PrevPoint.FloatValue, 'g', -1, 64)
+	} else {
+		v.PrevValue = strconv.FormatInt(state.PrevPoint.IntValue, 10)
+	}
+	return v
+}
+
+// attributesString renders attributes as sorted, comma separated key=value
+// pairs. The attributes are copied before sorting, as they are shared with
+// the tracker.
+func attributesString(attrs pdata.AttributeMap) string {
+	sorted := pdata.NewAttributeMap()
+	attrs.CopyTo(sorted)
+	var b strings.Builder
+	sorted.Sort().Range(func(k string, v pdata.AttributeValue) bool {
+		if b.Len() > 0 {
+			b.WriteString(", ")
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(tracetranslator.AttributeValueToString(v))
+		return true
+	})
+	return b.String()
+}
@@ -0,0 +1,127 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config/confignet"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestDebugHandler(t *testing.T) {
+	p := newCumulativeToDeltaProcessor(createDefaultConfig().(*Config), zap.NewNop(), consumertest.NewNop())
+	md := generateTestMetrics(testMetric{
+		metricNames:  []string{"metric_1", "metric_2"},
+		metricValues: [][]float64{{100}, {4}},
+		isCumulative: []bool{true, true},
+	})
+	ms := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	ms.At(0).Sum().DataPoints().At(0).Attributes().InsertString("host", "a")
+	ms.At(1).Sum().DataPoints().At(0).Attributes().InsertString("host", "b")
+	_, err := p.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+	handler := p.debugHandler()
+
+	list := func(query string) []seriesView {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, debugPathPrefix+"/series?format=json"+query, nil))
+		require.Equal(t, http.StatusOK, rec.Code)
+		var views []seriesView
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &views))
+		return views
+	}
+
+	views := list("")
+	require.Equal(t, 2, len(views))
+	assert.Equal(t, "metric_1", views[0].Metric)
+	assert.Equal(t, "host=a", views[0].Attributes)
+	assert.Equal(t, "100", views[0].PrevValue)
+	assert.True(t, views[0].Monotonic)
+
+	views = list("&metric=metric_2")
+	require.Equal(t, 1, len(views))
+	assert.Equal(t, "metric_2", views[0].Metric)
+
+	views = list("&attr=host=a")
+	require.Equal(t, 1, len(views))
+	assert.Equal(t, "metric_1", views[0].Metric)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, debugPathPrefix+"/series", nil))
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "metric_1")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, debugPathPrefix+"/series/delete?key="+views[0].Key, nil))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	views = list("")
+	require.Equal(t, 1, len(views))
+	assert.Equal(t, "metric_2", views[0].Metric)
+
+	req := httptest.NewRequest(http.MethodPost, debugPathPrefix+"/series/delete?key="+views[0].Key, nil)
+	req.Header.Set("Origin", "http://other.example")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodDelete, debugPathPrefix+"/series/delete?key=bm9uZQ", nil))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, debugPathPrefix+"/series/delete?key="+views[0].Key, nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestDebugServerLifecycle(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Debug = &confignet.TCPAddr{Endpoint: "localhost:0"}
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), consumertest.NewNop())
+	require.NoError(t, p.Start(context.Background(), componenttest.NewNopHost()))
+	require.NotNil(t, p.debugServer)
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestDebugEndpoint(t *testing.T) {
+	assert.Equal(t, "localhost:55690", debugEndpoint(":55690"))
+	assert.Equal(t, "localhost:0", debugEndpoint(""))
+	assert.Equal(t, "0.0.0.0:55690", debugEndpoint("0.0.0.0:55690"))
+	assert.Equal(t, "collector:55690", debugEndpoint("collector:55690"))
+}
+
+func TestAttributesString(t *testing.T) {
+	attrs := pdata.NewAttributeMap()
+	attrs.InsertString("b", "2")
+	attrs.InsertInt("a", 1)
+	assert.Equal(t, "a=1, b=2", attributesString(attrs))
+
+	// The attributes of the series are left as they are
+	var keys []string
+	attrs.Range(func(k string, _ pdata.AttributeValue) bool {
+		keys = append(keys, k)
+		return true
+	})
+	assert.Equal(t, []string{"b", "a"}, keys)
+}
@@ -17,7 +17,9 @@ package cumulativetodeltaprocessor
 import (
 	"context"
 	"fmt"
+	"time"
 
+	"go.opencensus.io/stats/view"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer"
@@ -41,8 +43,21 @@ func NewFactory() component.ProcessorFactory {
 
 func createDefaultConfig() config.Processor {
 	return &Config{
-		ProcessorSettings: config.NewProcessorSettings(config.NewID(typeStr)),
-		MonotonicOnly:     true,
+		ProcessorSettings:  config.NewProcessorSettings(config.NewID(typeStr)),
+		Mode:               modeConvert,
+		MonotonicOnly:      true,
+		NonMonotonicOutput: nonMonotonicOutputDelta,
+		StalenessClock:     stalenessClockPointTime,
+		MissingStart:       missingStartProcessorStart,
+		CreatedSeries:      createdSeriesIgnore,
+		GapAction:          gapActionDrop,
+		DropEmpty:          dropEmptyResources,
+		Logging: LoggingConfig{
+			Level:              "info",
+			SamplingInitial:    10,
+			SamplingThereafter: 100,
+			SamplingTick:       time.Second,
+		},
 	}
 }
 
@@ -57,11 +72,19 @@ func createMetricsProcessor(
 		return nil, fmt.Errorf("configuration parsing error")
 	}
 
-	metricsProcessor := newCumulativeToDeltaProcessor(processorConfig, params.Logger)
+	// Registering the views again is a no-op, it only fails when other
+	// views with their names are registered.
+	if err := view.Register(MetricViews()...); err != nil {
+		return nil, fmt.Errorf("registering the telemetry views: %w", err)
+	}
+
+	metricsProcessor := newCumulativeToDeltaProcessor(processorConfig, params.Logger, nextConsumer)
 
 	return processorhelper.NewMetricsProcessor(
 		cfg,
 		nextConsumer,
 		metricsProcessor.processMetrics,
-		processorhelper.WithCapabilities(processorCapabilities))
+		processorhelper.WithCapabilities(processorCapabilities),
+		processorhelper.WithStart(metricsProcessor.Start),
+		processorhelper.WithShutdown(metricsProcessor.Shutdown))
 }
@@ -19,6 +19,7 @@ import (
 	"fmt"
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"go.opentelemetry.io/collector/component/componenttest"
@@ -38,8 +39,21 @@ func TestCreateDefaultConfig(t *testing.T) {
 	factory := NewFactory()
 	cfg := factory.CreateDefaultConfig()
 	assert.Equal(t, cfg, &Config{
-		ProcessorSettings: config.NewProcessorSettings(config.NewID(typeStr)),
-		MonotonicOnly:     true,
+		ProcessorSettings:  config.NewProcessorSettings(config.NewID(typeStr)),
+		Mode:               "convert",
+		MonotonicOnly:      true,
+		NonMonotonicOutput: nonMonotonicOutputDelta,
+		MissingStart:       missingStartProcessorStart,
+		CreatedSeries:      createdSeriesIgnore,
+		GapAction:          gapActionDrop,
+		StalenessClock:     "point_time",
+		DropEmpty:          "resources",
+		Logging: LoggingConfig{
+			Level:              "info",
+			SamplingInitial:    10,
+			SamplingThereafter: 100,
+			SamplingTick:       time.Second,
+		},
 	})
 	assert.NoError(t, configcheck.ValidateConfig(cfg))
 }
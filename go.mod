@@ -4,7 +4,9 @@ go 1.16
 
 require (
 	github.com/stretchr/testify v1.7.0
+	go.opencensus.io v0.23.0
 	go.opentelemetry.io/collector v0.32.0
 	go.opentelemetry.io/collector/model v0.32.0
 	go.uber.org/zap v1.19.0
+	gopkg.in/yaml.v2 v2.4.0
 )
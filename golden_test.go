@@ -0,0 +1,285 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"context"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/config/configparser"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/model/pdata"
+	tracetranslator "go.opentelemetry.io/collector/translator/trace"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v2"
+)
+
+var update = flag.Bool("update", false, "regenerate the golden files under testdata/golden")
+
+// goldenPoint is a data point along with the resource, instrumentation
+// library and metric it belongs to. Consecutive points of the same
+// resource, library or metric are grouped under it.
+type goldenPoint struct {
+	Resource map[string]string `yaml:"resource,omitempty"`
+	Library  string            `yaml:"library,omitempty"`
+	Metric   string            `yaml:"metric"`
+	Unit     string            `yaml:"unit,omitempty"`
+	// Type is "sum" or "gauge". Default: sum.
+	Type string `yaml:"type,omitempty"`
+	// Temporality of a sum, "cumulative", "delta" or "unspecified". Default: cumulative.
+	Temporality string            `yaml:"temporality,omitempty"`
+	Monotonic   bool              `yaml:"monotonic,omitempty"`
+	Attributes  map[string]string `yaml:"attributes,omitempty"`
+	// Start and Time are in seconds since the epoch.
+	Start  float64  `yaml:"start,omitempty"`
+	Time   float64  `yaml:"time"`
+	Int    *int64   `yaml:"int,omitempty"`
+	Double *float64 `yaml:"double,omitempty"`
+}
+
+// goldenBatch is the list of points in a pdata.Metrics.
+type goldenBatch []goldenPoint
+
+var goldenTemporalities = map[string]pdata.AggregationTemporality{
+	"":            pdata.AggregationTemporalityCumulative,
+	"cumulative":  pdata.AggregationTemporalityCumulative,
+	"delta":       pdata.AggregationTemporalityDelta,
+	"unspecified": pdata.AggregationTemporalityUnspecified,
+}
+
+func goldenTimestamp(seconds float64) pdata.Timestamp {
+	return pdata.Timestamp(seconds * float64(time.Second))
+}
+
+func goldenSeconds(ts pdata.Timestamp) float64 {
+	return float64(ts) / float64(time.Second)
+}
+
+func (b goldenBatch) metrics(t *testing.T) pdata.Metrics {
+	md := pdata.NewMetrics()
+	var rm pdata.ResourceMetrics
+	var ilm pdata.InstrumentationLibraryMetrics
+	var m pdata.Metric
+	var prev *goldenPoint
+	for i := range b {
+		p := &b[i]
+		newResource := prev == nil || !equalStringMaps(prev.Resource, p.Resource)
+		newLibrary := newResource || prev.Library != p.Library
+		newMetric := newLibrary || prev.Metric != p.Metric || prev.Unit != p.Unit || prev.Type != p.Type ||
+			prev.Temporality != p.Temporality || prev.Monotonic != p.Monotonic
+		prev = p
+
+		if newResource {
+			rm = md.ResourceMetrics().AppendEmpty()
+			for k, v := range p.Resource {
+				rm.Resource().Attributes().InsertString(k, v)
+			}
+		}
+		if newLibrary {
+			ilm = rm.InstrumentationLibraryMetrics().AppendEmpty()
+			ilm.InstrumentationLibrary().SetName(p.Library)
+		}
+		if newMetric {
+			m = ilm.Metrics().AppendEmpty()
+			m.SetName(p.Metric)
+			m.SetUnit(p.Unit)
+			switch p.Type {
+			case "", "sum":
+				m.SetDataType(pdata.MetricDataTypeSum)
+				temporality, ok := goldenTemporalities[p.Temporality]
+				require.True(t, ok, "invalid temporality %q", p.Temporality)
+				m.Sum().SetAggregationTemporality(temporality)
+				m.Sum().SetIsMonotonic(p.Monotonic)
+			case "gauge":
+				m.SetDataType(pdata.MetricDataTypeGauge)
+			default:
+				t.Fatalf("invalid type %q", p.Type)
+			}
+		}
+
+		var dp pdata.NumberDataPoint
+		if m.DataType() == pdata.MetricDataTypeSum {
+			dp = m.Sum().DataPoints().AppendEmpty()
+		} else {
+			dp = m.Gauge().DataPoints().AppendEmpty()
+		}
+		for k, v := range p.Attributes {
+			dp.Attributes().InsertString(k, v)
+		}
+		dp.SetStartTimestamp(goldenTimestamp(p.Start))
+		dp.SetTimestamp(goldenTimestamp(p.Time))
+		switch {
+		case p.Int != nil:
+			dp.SetIntVal(*p.Int)
+		case p.Double != nil:
+			dp.SetDoubleVal(*p.Double)
+		default:
+			t.Fatalf("point of %s has neither an int nor a double value", p.Metric)
+		}
+	}
+	return md
+}
+
+func newGoldenBatch(md pdata.Metrics) goldenBatch {
+	b := goldenBatch{}
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		ilms := rm.InstrumentationLibraryMetrics()
+		for j := 0; j < ilms.Len(); j++ {
+			ilm := ilms.At(j)
+			ms := ilm.Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				m := ms.At(k)
+				base := goldenPoint{
+					Resource: goldenAttributes(rm.Resource().Attributes()),
+					Library:  ilm.InstrumentationLibrary().Name(),
+					Metric:   m.Name(),
+					Unit:     m.Unit(),
+				}
+				var dps pdata.NumberDataPointSlice
+				switch m.DataType() {
+				case pdata.MetricDataTypeSum:
+					dps = m.Sum().DataPoints()
+					base.Temporality = "cumulative"
+					switch m.Sum().AggregationTemporality() {
+					case pdata.AggregationTemporalityDelta:
+						base.Temporality = "delta"
+					case pdata.AggregationTemporalityUnspecified:
+						base.Temporality = "unspecified"
+					}
+					base.Monotonic = m.Sum().IsMonotonic()
+				case pdata.MetricDataTypeGauge:
+					dps = m.Gauge().DataPoints()
+					base.Type = "gauge"
+				default:
+					continue
+				}
+				for l := 0; l < dps.Len(); l++ {
+					dp := dps.At(l)
+					p := base
+					p.Attributes = goldenAttributes(dp.Attributes())
+					p.Start = goldenSeconds(dp.StartTimestamp())
+					p.Time = goldenSeconds(dp.Timestamp())
+					if dp.Type() == pdata.MetricValueTypeInt {
+						v := dp.IntVal()
+						p.Int = &v
+					} else {
+						v := dp.DoubleVal()
+						p.Double = &v
+					}
+					b = append(b, p)
+				}
+			}
+		}
+	}
+	return b
+}
+
+func goldenAttributes(attrs pdata.AttributeMap) map[string]string {
+	if attrs.Len() == 0 {
+		return nil
+	}
+	out := make(map[string]string, attrs.Len())
+	attrs.Range(func(k string, v pdata.AttributeValue) bool {
+		out[k] = tracetranslator.AttributeValueToString(v)
+		return true
+	})
+	return out
+}
+
+func equalStringMaps(a, b map[string]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+	return true
+}
+
+// TestGolden runs the batches of each testdata/golden/<case>/input.yaml
+// through the processor configured by config.yaml, when present, and
+// compares the converted batches, each followed by the batches sent in the
+// background while converting it, with output.yaml. Run with -update to
+// regenerate output.yaml.
+func TestGolden(t *testing.T) {
+	dirs, err := filepath.Glob(filepath.Join("testdata", "golden", "*"))
+	require.NoError(t, err)
+	sort.Strings(dirs)
+	require.NotEmpty(t, dirs)
+
+	for _, dir := range dirs {
+		dir := dir
+		t.Run(filepath.Base(dir), func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			configFile := filepath.Join(dir, "config.yaml")
+			if _, err := os.Stat(configFile); err == nil {
+				parser, err := configparser.NewParserFromFile(configFile)
+				require.NoError(t, err)
+				require.NoError(t, parser.UnmarshalExact(cfg))
+			}
+			require.NoError(t, cfg.Validate())
+
+			buf, err := ioutil.ReadFile(filepath.Join(dir, "input.yaml"))
+			require.NoError(t, err)
+			var input []goldenBatch
+			require.NoError(t, yaml.UnmarshalStrict(buf, &input))
+
+			next := new(consumertest.MetricsSink)
+			p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), next)
+			output := []goldenBatch{}
+			// Deltas sent in the background follow the batch converted
+			// before them
+			var sent int
+			appendSent := func() {
+				all := next.AllMetrics()
+				for _, md := range all[sent:] {
+					output = append(output, newGoldenBatch(md))
+				}
+				sent = len(all)
+			}
+			for _, batch := range input {
+				md, err := p.processMetrics(context.Background(), batch.metrics(t))
+				require.NoError(t, err)
+				output = append(output, newGoldenBatch(md))
+				appendSent()
+			}
+			require.NoError(t, p.Shutdown(context.Background()))
+			appendSent()
+
+			got, err := yaml.Marshal(output)
+			require.NoError(t, err)
+			goldenFile := filepath.Join(dir, "output.yaml")
+			if *update {
+				require.NoError(t, ioutil.WriteFile(goldenFile, got, 0600))
+				return
+			}
+			want, err := ioutil.ReadFile(goldenFile)
+			require.NoError(t, err, "run with -update to create the golden file")
+			assert.Equal(t, string(want), string(got))
+		})
+	}
+}
@@ -0,0 +1,105 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/obsreport"
+)
+
+var (
+	processorTagKey = tag.MustNewKey("processor")
+	modeTagKey      = tag.MustNewKey("mode")
+	eventTagKey     = tag.MustNewKey("event")
+
+	statPointsConverted = stats.Int64("points_converted", "Number of cumulative points converted to deltas", stats.UnitDimensionless)
+	statPointsDropped   = stats.Int64("points_dropped", "Number of cumulative points dropped instead of being converted", stats.UnitDimensionless)
+	statPointsDeferred  = stats.Int64("points_deferred", "Number of cumulative points whose delta is sent later, accumulated or carried over to the next bucket", stats.UnitDimensionless)
+	statPointsGauge     = stats.Int64("points_gauge", "Number of cumulative points turned into gauge points of their current value", stats.UnitDimensionless)
+	statEvents          = stats.Int64("events", "Number of conversion events, such as counter resets, out of order points and gaps", stats.UnitDimensionless)
+	statDeltaValue      = stats.Float64("delta_value", "Values of the emitted deltas", stats.UnitDimensionless)
+)
+
+// metricViews are created once, as registering the same views again is a
+// no-op while registering equal ones fails for distributions.
+var metricViews = newMetricViews()
+
+// MetricViews returns the metrics views related to the conversion.
+func MetricViews() []*view.View {
+	return append([]*view.View(nil), metricViews...)
+}
+
+func newMetricViews() []*view.View {
+	tagKeys := []tag.Key{processorTagKey, modeTagKey}
+
+	countPointsConvertedView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statPointsConverted.Name()),
+		Measure:     statPointsConverted,
+		Description: statPointsConverted.Description(),
+		TagKeys:     tagKeys,
+		Aggregation: view.Sum(),
+	}
+
+	countPointsDroppedView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statPointsDropped.Name()),
+		Measure:     statPointsDropped,
+		Description: statPointsDropped.Description(),
+		TagKeys:     tagKeys,
+		Aggregation: view.Sum(),
+	}
+
+	countPointsDeferredView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statPointsDeferred.Name()),
+		Measure:     statPointsDeferred,
+		Description: statPointsDeferred.Description(),
+		TagKeys:     tagKeys,
+		Aggregation: view.Sum(),
+	}
+
+	countPointsGaugeView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statPointsGauge.Name()),
+		Measure:     statPointsGauge,
+		Description: statPointsGauge.Description(),
+		TagKeys:     tagKeys,
+		Aggregation: view.Sum(),
+	}
+
+	countEventsView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statEvents.Name()),
+		Measure:     statEvents,
+		Description: statEvents.Description(),
+		TagKeys:     append([]tag.Key{eventTagKey}, tagKeys...),
+		Aggregation: view.Sum(),
+	}
+
+	distributionDeltaValueView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statDeltaValue.Name()),
+		Measure:     statDeltaValue,
+		Description: statDeltaValue.Description(),
+		TagKeys:     tagKeys,
+		Aggregation: view.Distribution(0, 1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e7, 1e8, 1e9, 1e10, 1e12),
+	}
+
+	return []*view.View{
+		countPointsConvertedView,
+		countPointsDroppedView,
+		countPointsDeferredView,
+		countPointsGaugeView,
+		countEventsView,
+		distributionDeltaValueView,
+	}
+}
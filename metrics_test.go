@@ -0,0 +1,84 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cumulativetodeltaprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/obsreport"
+)
+
+func TestProcessorMetrics(t *testing.T) {
+	viewNames := []string{
+		"points_converted",
+		"points_dropped",
+		"points_deferred",
+		"points_gauge",
+		"events",
+		"delta_value",
+	}
+	views := MetricViews()
+	for i, viewName := range viewNames {
+		assert.Equal(t, "processor/cumulativetodelta/"+viewName, views[i].Name)
+	}
+}
+
+// registerMetricViews registers the views unless creating a processor
+// already did.
+func registerMetricViews(t *testing.T) {
+	views := MetricViews()
+	if view.Find(views[0].Name) == nil {
+		require.NoError(t, view.Register(views...))
+	}
+}
+
+// viewValue returns the sum, or for distributions the count, recorded by
+// the view of metric in the row with the given tags.
+func viewValue(t *testing.T, metric string, tags ...tag.Tag) float64 {
+	rows, err := view.RetrieveData(obsreport.BuildProcessorCustomMetricName(typeStr, metric))
+	require.NoError(t, err)
+	for _, row := range rows {
+		if !hasTags(row.Tags, tags) {
+			continue
+		}
+		switch data := row.Data.(type) {
+		case *view.SumData:
+			return data.Value
+		case *view.DistributionData:
+			return float64(data.Count)
+		}
+	}
+	return 0
+}
+
+func hasTags(rowTags, want []tag.Tag) bool {
+	for _, w := range want {
+		found := false
+		for _, rt := range rowTags {
+			if rt == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
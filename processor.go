@@ -15,130 +15,684 @@
 package cumulativetodeltaprocessor
 
 import (
+	"bytes"
 	"context"
+	"net/http"
+	"sort"
 
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confignet"
+	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/model/pdata"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 
 	"github.com/a-feld/cumulativetodeltaprocessor/tracking"
 )
 
 type cumulativeToDeltaProcessor struct {
 	metrics         map[string]struct{}
+	policies        map[string]tracking.Policy
+	defaultPolicy   tracking.Policy
 	logger          *zap.Logger
 	deltaCalculator tracking.MetricTracker
 	monotonicOnly   bool
+	gaugeOutput     bool
+	inferMonotonic  bool
+	useCreated      bool
+	dropCreated     bool
+	sortPoints      bool
+	windowed        bool
+	dropMetrics     bool
+	dropLibraries   bool
+	dropResources   bool
+	nextConsumer    consumer.Metrics
+	shadow          bool
+	telemetryTags   []tag.Mutator
+	debug           *confignet.TCPAddr
+	debugServer     *http.Server
+	debugStopped    chan struct{}
 	cancelFunc      context.CancelFunc
 }
 
-func newCumulativeToDeltaProcessor(config *Config, logger *zap.Logger) *cumulativeToDeltaProcessor {
+// newCumulativeToDeltaProcessor returns a processor configured by config.
+// extraOpts are added to the options of its tracker, such as a clock in
+// tests.
+func newCumulativeToDeltaProcessor(config *Config, logger *zap.Logger, nextConsumer consumer.Metrics, extraOpts ...tracking.Option) *cumulativeToDeltaProcessor {
 	ctx, cancel := context.WithCancel(context.Background())
 	p := &cumulativeToDeltaProcessor{
-		logger:          logger,
-		deltaCalculator: tracking.NewMetricTracker(ctx, logger, config.MaxStale),
-		monotonicOnly:   config.MonotonicOnly,
-		cancelFunc:      cancel,
+		logger:         logger,
+		monotonicOnly:  config.MonotonicOnly || config.NonMonotonicOutput == nonMonotonicOutputPassthrough,
+		gaugeOutput:    config.NonMonotonicOutput == nonMonotonicOutputGauge,
+		inferMonotonic: config.InferMonotonicity > 0,
+		useCreated:     config.CreatedSeries == createdSeriesUse || config.CreatedSeries == createdSeriesUseAndDrop,
+		dropCreated:    config.CreatedSeries == createdSeriesUseAndDrop,
+		sortPoints:     config.SortPoints,
+		windowed:       config.Window != nil,
+		nextConsumer:   nextConsumer,
+		debug:          config.Debug,
+		cancelFunc:     cancel,
+		shadow:         config.Mode == modeShadow,
 	}
+	mode := modeConvert
+	if p.shadow {
+		mode = modeShadow
+	}
+	p.telemetryTags = []tag.Mutator{
+		tag.Upsert(processorTagKey, config.ID().String()),
+		tag.Upsert(modeTagKey, mode),
+	}
+	switch config.DropEmpty {
+	case dropEmptyNone:
+	case dropEmptyMetrics:
+		p.dropMetrics = true
+	case dropEmptyLibraries:
+		p.dropMetrics, p.dropLibraries = true, true
+	default:
+		p.dropMetrics, p.dropLibraries, p.dropResources = true, true, true
+	}
+	opts := []tracking.Option{tracking.WithEventFunc(p.recordEvent)}
+	if config.SweepInterval > 0 {
+		opts = append(opts, tracking.WithSweepInterval(config.SweepInterval))
+	}
+	if config.StalenessClock == stalenessClockReceiveTime {
+		opts = append(opts, tracking.WithStalenessClock(tracking.ReceiveTime))
+	}
+	if config.MissingStart == missingStartDrop {
+		opts = append(opts, tracking.WithMissingStart(tracking.MissingStartDrop))
+	}
+	if config.InferMonotonicity > 0 {
+		opts = append(opts, tracking.WithMonotonicityInference(config.InferMonotonicity))
+	}
+	if config.HeartbeatInterval > 0 {
+		opts = append(opts, tracking.WithHeartbeat(config.HeartbeatInterval, p.exportDeltas))
+	}
+	opts = append(opts, tracking.WithGapSpread(p.exportDeltas))
+	if config.Window != nil {
+		// The configuration is validated before the processor is created
+		windows, _ := config.Window.windows()
+		opts = append(opts, tracking.WithWindows(windows, p.exportTotals))
+	}
+	if config.AlignInterval > 0 {
+		opts = append(opts, tracking.WithAlignment(config.AlignInterval, p.exportDeltas))
+	}
+	if config.FlushInterval > 0 {
+		opts = append(opts, tracking.WithAggregation(config.FlushInterval, p.exportDeltas))
+	}
+	if config.Logging.Enabled {
+		opts = append(opts, tracking.WithEventLogger(newEventLogger(logger, config.Logging)))
+	}
+	opts = append(opts, extraOpts...)
+	p.deltaCalculator = tracking.NewMetricTracker(ctx, logger, config.MaxStale, opts...)
 	if len(config.Metrics) > 0 {
 		p.metrics = make(map[string]struct{}, len(config.Metrics))
 		for _, m := range config.Metrics {
 			p.metrics[m] = struct{}{}
 		}
 	}
+	p.defaultPolicy = tracking.Policy{
+		MaxGap:    config.MaxGap,
+		GapAction: newGapAction(config.GapAction),
+	}
+	if len(config.Rules) > 0 {
+		p.policies = make(map[string]tracking.Policy)
+		for _, rule := range config.Rules {
+			policy := newPolicy(p.defaultPolicy, rule)
+			for _, m := range rule.Metrics {
+				if _, ok := p.policies[m]; !ok {
+					p.policies[m] = policy
+				}
+			}
+		}
+	}
 	return p
 }
 
+// newPolicy returns the tracking policy configured by rule, with the
+// settings the rule leaves out taken from defaults.
+func newPolicy(defaults tracking.Policy, rule RuleConfig) tracking.Policy {
+	policy := defaults
+	switch rule.Wraparound {
+	case wraparound32:
+		policy.Wraparound = tracking.Wraparound32
+	case wraparound64:
+		policy.Wraparound = tracking.Wraparound64
+	}
+	switch rule.InvalidValues {
+	case invalidValuesFlag:
+		policy.InvalidValues = tracking.InvalidFlag
+	case invalidValuesReset:
+		policy.InvalidValues = tracking.InvalidReset
+	}
+	if rule.MaxGap > 0 {
+		policy.MaxGap = rule.MaxGap
+	}
+	if rule.GapAction != "" {
+		policy.GapAction = newGapAction(rule.GapAction)
+	}
+	policy.MaxDelta = rule.MaxDelta
+	policy.MaxDeltaFactor = rule.MaxDeltaFactor
+	switch rule.OutlierAction {
+	case outlierActionClamp:
+		policy.OutlierAction = tracking.OutlierClamp
+	case outlierActionFlag:
+		policy.OutlierAction = tracking.OutlierFlag
+	}
+	switch rule.UnspecifiedTemporality {
+	case unspecifiedTemporalityCumulative:
+		policy.Unspecified = tracking.UnspecifiedCumulative
+	case unspecifiedTemporalityInfer:
+		policy.Unspecified = tracking.UnspecifiedInfer
+	}
+	return policy
+}
+
+func newGapAction(action string) tracking.GapAction {
+	switch action {
+	case gapActionEmit:
+		return tracking.GapEmit
+	case gapActionSpread:
+		return tracking.GapSpread
+	default:
+		return tracking.GapDrop
+	}
+}
+
+// policy returns the tracking policy of the metric called name.
+func (ctdp *cumulativeToDeltaProcessor) policy(name string) tracking.Policy {
+	if policy, ok := ctdp.policies[name]; ok {
+		return policy
+	}
+	return ctdp.defaultPolicy
+}
+
+// newEventLogger returns a logger sampling conversion events, so that a
+// storm of resets can't flood the logs, and the level to log them at.
+func newEventLogger(logger *zap.Logger, cfg LoggingConfig) (*zap.Logger, zapcore.Level) {
+	var level zapcore.Level
+	_ = level.UnmarshalText([]byte(cfg.Level))
+	sampled := logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return zapcore.NewSamplerWithOptions(core, cfg.SamplingTick, cfg.SamplingInitial, cfg.SamplingThereafter)
+	}))
+	return sampled, level
+}
+
 // Start is invoked during service startup.
-func (ctdp *cumulativeToDeltaProcessor) Start(context.Context, component.Host) error {
+func (ctdp *cumulativeToDeltaProcessor) Start(_ context.Context, host component.Host) error {
+	if ctdp.debug == nil {
+		return nil
+	}
+
+	// Start the listener here so we can have earlier failure if port is
+	// already in use.
+	addr := *ctdp.debug
+	addr.Endpoint = debugEndpoint(addr.Endpoint)
+	ln, err := addr.Listen()
+	if err != nil {
+		return err
+	}
+	ctdp.logger.Info("Serving tracked series state", zap.String("endpoint", ln.Addr().String()+debugPathPrefix+"/series"))
+	ctdp.debugServer = &http.Server{Handler: ctdp.debugHandler()}
+	ctdp.debugStopped = make(chan struct{})
+	go func() {
+		defer close(ctdp.debugStopped)
+
+		if err := ctdp.debugServer.Serve(ln); err != nil && err != http.ErrServerClosed {
+			host.ReportFatalError(err)
+		}
+	}()
 	return nil
 }
 
 // processMetrics implements the ProcessMetricsFunc type.
 func (ctdp *cumulativeToDeltaProcessor) processMetrics(_ context.Context, md pdata.Metrics) (pdata.Metrics, error) {
+	if ctdp.shadow {
+		// Convert a copy, so that the data passes through unchanged
+		ctdp.convertMetrics(md.Clone())
+		return md, nil
+	}
+	ctdp.convertMetrics(md)
+	return md, nil
+}
+
+// convertMetrics converts the cumulative sums of md to deltas in place.
+func (ctdp *cumulativeToDeltaProcessor) convertMetrics(md pdata.Metrics) {
+	var c conversionCounts
+	if ctdp.useCreated {
+		ctdp.applyCreatedTimes(md)
+	}
+	convert := ctdp.convert
+	var sorted *sortedConversions
+	if ctdp.sortPoints {
+		sorted = ctdp.sortConversions(md)
+		convert = sorted.next
+	}
 	resourceMetricsSlice := md.ResourceMetrics()
 	resourceMetricsSlice.RemoveIf(func(rm pdata.ResourceMetrics) bool {
 		ilms := rm.InstrumentationLibraryMetrics()
 		ilms.RemoveIf(func(ilm pdata.InstrumentationLibraryMetrics) bool {
 			ms := ilm.Metrics()
+			var split []cumulativeSplit
 			ms.RemoveIf(func(m pdata.Metric) bool {
-				if ctdp.metrics != nil {
-					if _, ok := ctdp.metrics[m.Name()]; !ok {
-						return false
-					}
+				sum, ok := ctdp.cumulativeSum(m)
+				if !ok {
+					return false
 				}
-				baseIdentity := tracking.MetricIdentity{
-					Resource:               rm.Resource(),
-					InstrumentationLibrary: ilm.InstrumentationLibrary(),
-					MetricDataType:         m.DataType(),
-					MetricName:             m.Name(),
-					MetricUnit:             m.Unit(),
+				if ctdp.toGauge(sum) {
+					c.gauge += int64(sum.DataPoints().Len())
+					sumToGauge(m)
+					return ctdp.dropMetrics && m.Gauge().DataPoints().Len() == 0
 				}
-				switch m.DataType() {
-				case pdata.MetricDataTypeSum:
-					ms := m.Sum()
-					if ms.AggregationTemporality() != pdata.AggregationTemporalityCumulative {
-						return false
-					}
-					if ctdp.monotonicOnly && !ms.IsMonotonic() {
-						return false
+				baseIdentity := newBaseIdentity(rm, ilm, m)
+				temporality := sum.AggregationTemporality()
+				kept := ctdp.convertDataPoints(sum.DataPoints(), baseIdentity, ctdp.policy(m.Name()), temporality, convert, &c)
+				if ctdp.windowed {
+					// Totals of windows are cumulative from the window start
+					sum.SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+				} else {
+					sum.SetAggregationTemporality(pdata.AggregationTemporalityDelta)
+				}
+				if len(kept) > 0 {
+					if sum.DataPoints().Len() > 0 {
+						split = append(split, cumulativeSplit{metric: m, temporality: temporality, points: kept})
+					} else {
+						// None of the series was converted
+						sum.SetAggregationTemporality(temporality)
+						appendDataPoints(sum.DataPoints(), kept)
 					}
-					baseIdentity.MetricIsMonotonic = ms.IsMonotonic()
-					ctdp.convertDataPoints(ms.DataPoints(), baseIdentity)
-					ms.SetAggregationTemporality(pdata.AggregationTemporalityDelta)
-					return ms.DataPoints().Len() == 0
-				default:
-					return false
 				}
+				return ctdp.dropMetrics && sum.DataPoints().Len() == 0
 			})
-			return ilm.Metrics().Len() == 0
+			for _, s := range split {
+				s.appendTo(ms)
+			}
+			return ctdp.dropLibraries && ilm.Metrics().Len() == 0
 		})
-		return rm.InstrumentationLibraryMetrics().Len() == 0
+		return ctdp.dropResources && rm.InstrumentationLibraryMetrics().Len() == 0
 	})
-	return md, nil
+	if sorted != nil && !sorted.done() {
+		ctdp.logger.Error("The points converted differ from the points sorted for conversion")
+	}
+	stats.RecordWithTags(context.Background(), ctdp.telemetryTags,
+		statPointsConverted.M(c.converted),
+		statPointsDropped.M(c.dropped),
+		statPointsDeferred.M(c.deferred),
+		statPointsGauge.M(c.gauge))
+}
+
+// toGauge reports whether sum, to be converted, becomes a gauge instead of
+// a delta sum.
+func (ctdp *cumulativeToDeltaProcessor) toGauge(sum pdata.Sum) bool {
+	return ctdp.gaugeOutput && !sum.IsMonotonic()
+}
+
+// cumulativeSum returns the sum of m when it is to be converted.
+func (ctdp *cumulativeToDeltaProcessor) cumulativeSum(m pdata.Metric) (pdata.Sum, bool) {
+	if ctdp.metrics != nil {
+		if _, ok := ctdp.metrics[m.Name()]; !ok {
+			return pdata.Sum{}, false
+		}
+	}
+	if m.DataType() != pdata.MetricDataTypeSum {
+		return pdata.Sum{}, false
+	}
+	sum := m.Sum()
+	switch sum.AggregationTemporality() {
+	case pdata.AggregationTemporalityCumulative:
+	case pdata.AggregationTemporalityUnspecified:
+		if ctdp.policy(m.Name()).Unspecified == tracking.UnspecifiedIgnore {
+			return pdata.Sum{}, false
+		}
+	default:
+		return pdata.Sum{}, false
+	}
+	// Inferred monotonicity is checked per series
+	if ctdp.monotonicOnly && !ctdp.inferMonotonic && !sum.IsMonotonic() {
+		return pdata.Sum{}, false
+	}
+	return sum, true
+}
+
+// cumulativeSplit holds the points of a metric whose series were not
+// converted, while others were.
+type cumulativeSplit struct {
+	metric      pdata.Metric
+	temporality pdata.AggregationTemporality
+	points      []pdata.NumberDataPoint
+}
+
+// appendTo appends a sum of the points to ms, described like the metric
+// they were split from.
+func (s cumulativeSplit) appendTo(ms pdata.MetricSlice) {
+	m := ms.AppendEmpty()
+	m.SetName(s.metric.Name())
+	m.SetDescription(s.metric.Description())
+	m.SetUnit(s.metric.Unit())
+	m.SetDataType(pdata.MetricDataTypeSum)
+	m.Sum().SetIsMonotonic(s.metric.Sum().IsMonotonic())
+	m.Sum().SetAggregationTemporality(s.temporality)
+	appendDataPoints(m.Sum().DataPoints(), s.points)
+}
+
+func appendDataPoints(dest pdata.NumberDataPointSlice, points []pdata.NumberDataPoint) {
+	for _, dp := range points {
+		dp.CopyTo(dest.AppendEmpty())
+	}
+}
+
+// sumToGauge turns the sum m into a gauge of the current values of its
+// points, which have no start timestamp.
+func sumToGauge(m pdata.Metric) {
+	dps := pdata.NewNumberDataPointSlice()
+	m.Sum().DataPoints().MoveAndAppendTo(dps)
+	for i := 0; i < dps.Len(); i++ {
+		dps.At(i).SetStartTimestamp(0)
+	}
+	m.SetDataType(pdata.MetricDataTypeGauge)
+	dps.MoveAndAppendTo(m.Gauge().DataPoints())
+}
+
+// newBaseIdentity returns the identity shared by the points of the sum m.
+func newBaseIdentity(rm pdata.ResourceMetrics, ilm pdata.InstrumentationLibraryMetrics, m pdata.Metric) tracking.MetricIdentity {
+	return tracking.MetricIdentity{
+		Resource:               rm.Resource(),
+		InstrumentationLibrary: ilm.InstrumentationLibrary(),
+		MetricDataType:         m.DataType(),
+		MetricIsMonotonic:      m.Sum().IsMonotonic(),
+		MetricName:             m.Name(),
+		MetricUnit:             m.Unit(),
+	}
+}
+
+// conversion is the outcome of converting a point.
+type conversion struct {
+	delta tracking.DeltaValue
+	valid bool
+	// skipped is set when the point is left unconverted, as its series is
+	// not inferred to be cumulative.
+	skipped bool
+}
+
+// convert converts point, unless its sum has unspecified temporality and
+// its series is not inferred to be cumulative.
+func (ctdp *cumulativeToDeltaProcessor) convert(point tracking.MetricPoint) conversion {
+	if point.UnspecifiedTemporality && point.Policy.Unspecified == tracking.UnspecifiedInfer && !ctdp.deltaCalculator.Cumulative(point) {
+		return conversion{skipped: true}
+	}
+	var c conversion
+	c.delta, c.valid = ctdp.deltaCalculator.Convert(point)
+	return c
+}
+
+// sortedConversions are the conversions of the points of a batch, in the
+// order convertMetrics visits the points.
+type sortedConversions struct {
+	conversions []conversion
+	visited     int
+}
+
+// next returns the conversion of the next point visited.
+func (s *sortedConversions) next(tracking.MetricPoint) conversion {
+	if s.visited >= len(s.conversions) {
+		s.visited++
+		return conversion{}
+	}
+	c := s.conversions[s.visited]
+	s.visited++
+	return c
+}
+
+// done reports whether every conversion was visited, and no more.
+func (s *sortedConversions) done() bool {
+	return s.visited == len(s.conversions)
+}
+
+// sortConversions converts the points of md to be converted in timestamp
+// order, so that several points of a series in the batch are converted
+// oldest first whatever their position.
+func (ctdp *cumulativeToDeltaProcessor) sortConversions(md pdata.Metrics) *sortedConversions {
+	var points []tracking.MetricPoint
+	rms := md.ResourceMetrics()
+	for i := 0; i < rms.Len(); i++ {
+		rm := rms.At(i)
+		ilms := rm.InstrumentationLibraryMetrics()
+		for j := 0; j < ilms.Len(); j++ {
+			ilm := ilms.At(j)
+			ms := ilm.Metrics()
+			for k := 0; k < ms.Len(); k++ {
+				m := ms.At(k)
+				sum, ok := ctdp.cumulativeSum(m)
+				if !ok || ctdp.toGauge(sum) {
+					continue
+				}
+				baseIdentity := newBaseIdentity(rm, ilm, m)
+				policy := ctdp.policy(m.Name())
+				unspecified := sum.AggregationTemporality() == pdata.AggregationTemporalityUnspecified
+				dps := sum.DataPoints()
+				for l := 0; l < dps.Len(); l++ {
+					point := newMetricPoint(baseIdentity, dps.At(l))
+					point.Policy = policy
+					point.UnspecifiedTemporality = unspecified
+					points = append(points, point)
+				}
+			}
+		}
+	}
+
+	// Points of different series don't affect each other, sorting all of
+	// them orders the points of each series.
+	order := make([]int, len(points))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return points[order[i]].Value.ObservedTimestamp < points[order[j]].Value.ObservedTimestamp
+	})
+	conversions := make([]conversion, len(points))
+	for _, i := range order {
+		conversions[i] = ctdp.convert(points[i])
+	}
+
+	return &sortedConversions{conversions: conversions}
+}
+
+// conversionCounts counts the outcome of converting points.
+type conversionCounts struct {
+	converted int64
+	dropped   int64
+	deferred  int64
+	gauge     int64
 }
 
 // Shutdown is invoked during service shutdown.
 func (ctdp *cumulativeToDeltaProcessor) Shutdown(context.Context) error {
 	ctdp.cancelFunc()
+	ctdp.deltaCalculator.Flush()
+	if ctdp.debugServer != nil {
+		err := ctdp.debugServer.Close()
+		<-ctdp.debugStopped
+		return err
+	}
 	return nil
 }
 
-func (ctdp *cumulativeToDeltaProcessor) convertDataPoints(in interface{}, baseIdentity tracking.MetricIdentity) {
+// convertDataPoints converts the points of in, of a sum of the given
+// temporality, to deltas in place. The points of series which are not
+// converted, because they are inferred not to be monotonic or cumulative,
+// are removed and returned instead.
+func (ctdp *cumulativeToDeltaProcessor) convertDataPoints(in interface{}, baseIdentity tracking.MetricIdentity, policy tracking.Policy, temporality pdata.AggregationTemporality, convert func(tracking.MetricPoint) conversion, c *conversionCounts) (kept []pdata.NumberDataPoint) {
 	switch dps := in.(type) {
 	case pdata.NumberDataPointSlice:
 		dps.RemoveIf(func(dp pdata.NumberDataPoint) bool {
-			id := baseIdentity
-			id.StartTimestamp = dp.StartTimestamp()
-			id.Attributes = dp.Attributes()
-			id.MetricValueType = dp.Type()
-			point := tracking.ValuePoint{
-				ObservedTimestamp: dp.Timestamp(),
-			}
-			if id.IsFloatVal() {
-				point.FloatValue = dp.DoubleVal()
-			} else {
-				point.IntValue = dp.IntVal()
-			}
-			trackingPoint := tracking.MetricPoint{
-				Identity: id,
-				Value:    point,
+			trackingPoint := newMetricPoint(baseIdentity, dp)
+			trackingPoint.Policy = policy
+			trackingPoint.UnspecifiedTemporality = temporality == pdata.AggregationTemporalityUnspecified
+			id := trackingPoint.Identity
+			conv := convert(trackingPoint)
+			delta, valid := conv.delta, conv.valid
+
+			if conv.skipped || ctdp.inferMonotonic && ctdp.monotonicOnly && !ctdp.deltaCalculator.Monotonic(id) {
+				kept = append(kept, dp)
+				return true
 			}
-			delta, valid := ctdp.deltaCalculator.Convert(trackingPoint)
 
 			// When converting non-monotonic cumulative counters,
 			// the first data point is omitted since the initial
 			// reference is not assumed to be zero
 			if !valid {
+				if delta.Deferred {
+					c.deferred++
+				} else {
+					c.dropped++
+				}
 				return true
 			}
+			c.converted++
 			dp.SetStartTimestamp(delta.StartTimestamp)
+			if delta.EndTimestamp != 0 {
+				dp.SetTimestamp(delta.EndTimestamp)
+			}
 			if id.IsFloatVal() {
 				dp.SetDoubleVal(delta.FloatValue)
 			} else {
 				dp.SetIntVal(delta.IntValue)
 			}
+			if delta.Flag != tracking.FlagNone {
+				dp.Attributes().UpsertString(flagAttribute, delta.Flag.String())
+			}
+			ctdp.recordDelta(id, delta)
 			return false
 		})
 	}
+	return kept
+}
+
+// flagAttribute is the data point attribute marking a delta passed on
+// although it overflowed or came from an infinite value.
+const flagAttribute = "cumulativetodelta.flag"
+
+// newMetricPoint returns the tracking point of dp, a point of the metric
+// identified by baseIdentity.
+func newMetricPoint(baseIdentity tracking.MetricIdentity, dp pdata.NumberDataPoint) tracking.MetricPoint {
+	id := baseIdentity
+	id.StartTimestamp = dp.StartTimestamp()
+	id.Attributes = dp.Attributes()
+	id.MetricValueType = dp.Type()
+	point := tracking.ValuePoint{
+		ObservedTimestamp: dp.Timestamp(),
+	}
+	if id.IsFloatVal() {
+		point.FloatValue = dp.DoubleVal()
+	} else {
+		point.IntValue = dp.IntVal()
+	}
+	return tracking.MetricPoint{
+		Identity: id,
+		Value:    point,
+	}
+}
+
+// exportDeltas forwards deltas produced by the tracker outside of
+// processMetrics to the next consumer.
+func (ctdp *cumulativeToDeltaProcessor) exportDeltas(points []tracking.DeltaPoint) {
+	ctdp.export(points, pdata.AggregationTemporalityDelta)
+}
+
+// exportTotals sends the final totals of windows, closed by a delta
+// spanning their end, as cumulative points starting at the window start.
+func (ctdp *cumulativeToDeltaProcessor) exportTotals(points []tracking.DeltaPoint) {
+	ctdp.export(points, pdata.AggregationTemporalityCumulative)
+}
+
+// export sends points produced in the background as sums of the given
+// temporality.
+func (ctdp *cumulativeToDeltaProcessor) export(points []tracking.DeltaPoint, temporality pdata.AggregationTemporality) {
+	for _, p := range points {
+		ctdp.recordDelta(p.Identity, p.Value)
+	}
+	if ctdp.shadow {
+		return
+	}
+	md := pointsToSums(points, temporality)
+	if err := ctdp.nextConsumer.ConsumeMetrics(context.Background(), md); err != nil {
+		ctdp.logger.Warn("failed to export deltas", zap.Error(err))
+	}
+}
+
+// recordDelta records the value of a delta emitted for the series
+// identified by id.
+func (ctdp *cumulativeToDeltaProcessor) recordDelta(id tracking.MetricIdentity, delta tracking.DeltaValue) {
+	value := float64(delta.IntValue)
+	if id.IsFloatVal() {
+		value = delta.FloatValue
+	}
+	stats.RecordWithTags(context.Background(), ctdp.telemetryTags, statDeltaValue.M(value))
+}
+
+// recordEvent counts an event reported by the tracker.
+func (ctdp *cumulativeToDeltaProcessor) recordEvent(event tracking.Event) {
+	mutators := append([]tag.Mutator{tag.Upsert(eventTagKey, event.String())}, ctdp.telemetryTags...)
+	stats.RecordWithTags(context.Background(), mutators, statEvents.M(1))
+}
+
+// pointsToSums builds sums of the given temporality from points, grouping
+// them by resource, instrumentation library and metric.
+func pointsToSums(points []tracking.DeltaPoint, temporality pdata.AggregationTemporality) pdata.Metrics {
+	md := pdata.NewMetrics()
+	ilms := make(map[string]pdata.InstrumentationLibraryMetrics)
+	metrics := make(map[string]pdata.Metric)
+	noAttributes := pdata.NewAttributeMap()
+	b := &bytes.Buffer{}
+	for _, p := range points {
+		id := p.Identity
+
+		scope := tracking.MetricIdentity{
+			Resource:               id.Resource,
+			InstrumentationLibrary: id.InstrumentationLibrary,
+			Attributes:             noAttributes,
+		}
+		b.Reset()
+		scope.Write(b)
+		ilm, ok := ilms[b.String()]
+		if !ok {
+			rm := md.ResourceMetrics().AppendEmpty()
+			id.Resource.CopyTo(rm.Resource())
+			ilm = rm.InstrumentationLibraryMetrics().AppendEmpty()
+			id.InstrumentationLibrary.CopyTo(ilm.InstrumentationLibrary())
+			ilms[b.String()] = ilm
+		}
+
+		metricID := id
+		metricID.Attributes = noAttributes
+		metricID.StartTimestamp = 0
+		metricID.MetricValueType = pdata.MetricValueTypeNone
+		b.Reset()
+		metricID.Write(b)
+		m, ok := metrics[b.String()]
+		if !ok {
+			m = ilm.Metrics().AppendEmpty()
+			m.SetName(id.MetricName)
+			m.SetUnit(id.MetricUnit)
+			m.SetDataType(pdata.MetricDataTypeSum)
+			m.Sum().SetIsMonotonic(id.MetricIsMonotonic)
+			m.Sum().SetAggregationTemporality(temporality)
+			metrics[b.String()] = m
+		}
+
+		dp := m.Sum().DataPoints().AppendEmpty()
+		id.Attributes.CopyTo(dp.Attributes())
+		dp.SetStartTimestamp(p.Value.StartTimestamp)
+		dp.SetTimestamp(p.Timestamp)
+		if id.IsFloatVal() {
+			dp.SetDoubleVal(p.Value.FloatValue)
+		} else {
+			dp.SetIntVal(p.Value.IntValue)
+		}
+		if p.Value.Flag != tracking.FlagNone {
+			dp.Attributes().UpsertString(flagAttribute, p.Value.Flag.String())
+		}
+	}
+	return md
 }
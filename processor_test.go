@@ -16,17 +16,23 @@ package cumulativetodeltaprocessor
 
 import (
 	"context"
+	"math"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"go.opencensus.io/tag"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer/consumertest"
 	"go.opentelemetry.io/collector/model/pdata"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+
+	"github.com/a-feld/cumulativetodeltaprocessor/tracking"
 )
 
 type testMetric struct {
@@ -166,9 +172,10 @@ func generateTestMetrics(tm testMetric) pdata.Metrics {
 			sum.SetAggregationTemporality(pdata.AggregationTemporalityDelta)
 		}
 
-		for _, value := range tm.metricValues[i] {
+		// Points of the same series follow each other a nanosecond apart
+		for j, value := range tm.metricValues[i] {
 			dp := m.Sum().DataPoints().AppendEmpty()
-			dp.SetTimestamp(pdata.TimestampFromTime(now.Add(10 * time.Second)))
+			dp.SetTimestamp(pdata.TimestampFromTime(now.Add(10*time.Second + time.Duration(j))))
 			dp.SetDoubleVal(value)
 		}
 	}
@@ -176,6 +183,392 @@ func generateTestMetrics(tm testMetric) pdata.Metrics {
 	return md
 }
 
+func TestCumulativeToDeltaProcessor_Heartbeat(t *testing.T) {
+	next := new(consumertest.MetricsSink)
+	cfg := createDefaultConfig().(*Config)
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), next)
+
+	resource := pdata.NewResource()
+	resource.Attributes().InsertString("host", "a")
+	il := pdata.NewInstrumentationLibrary()
+	il.SetName("lib")
+	attributes := pdata.NewAttributeMap()
+	attributes.InsertString("label", "value")
+	id := tracking.MetricIdentity{
+		Resource:               resource,
+		InstrumentationLibrary: il,
+		MetricDataType:         pdata.MetricDataTypeSum,
+		MetricIsMonotonic:      true,
+		MetricName:             "metric_1",
+		MetricUnit:             "1",
+		Attributes:             attributes,
+		MetricValueType:        pdata.MetricValueTypeInt,
+	}
+	other := id
+	other.MetricName = "metric_2"
+
+	p.exportDeltas([]tracking.DeltaPoint{
+		{Identity: id, Value: tracking.DeltaValue{StartTimestamp: 10}, Timestamp: 20},
+		{Identity: other, Value: tracking.DeltaValue{StartTimestamp: 15}, Timestamp: 20},
+	})
+
+	got := next.AllMetrics()
+	require.Equal(t, 1, len(got))
+	require.Equal(t, 1, got[0].ResourceMetrics().Len())
+	rm := got[0].ResourceMetrics().At(0)
+	assert.Equal(t, resource, rm.Resource())
+	require.Equal(t, 1, rm.InstrumentationLibraryMetrics().Len())
+	ilm := rm.InstrumentationLibraryMetrics().At(0)
+	assert.Equal(t, "lib", ilm.InstrumentationLibrary().Name())
+	require.Equal(t, 2, ilm.Metrics().Len())
+
+	for i, name := range []string{"metric_1", "metric_2"} {
+		m := ilm.Metrics().At(i)
+		assert.Equal(t, name, m.Name())
+		assert.Equal(t, "1", m.Unit())
+		assert.Equal(t, pdata.AggregationTemporalityDelta, m.Sum().AggregationTemporality())
+		require.Equal(t, 1, m.Sum().DataPoints().Len())
+		dp := m.Sum().DataPoints().At(0)
+		assert.Equal(t, attributes, dp.Attributes())
+		assert.Equal(t, pdata.Timestamp(20), dp.Timestamp())
+		assert.Equal(t, int64(0), dp.IntVal())
+	}
+
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestCumulativeToDeltaProcessor_HeartbeatSweep(t *testing.T) {
+	tests := []struct {
+		name           string
+		stalenessClock string
+		// pointTime is the time of the point in seconds, received at
+		// 1000s.
+		pointTime float64
+	}{
+		{name: "Point time", stalenessClock: stalenessClockPointTime, pointTime: 1000},
+		// Heartbeats follow the clock of the source, far behind
+		{name: "Receive time", stalenessClock: stalenessClockReceiveTime, pointTime: 100},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			next := new(consumertest.MetricsSink)
+			cfg := createDefaultConfig().(*Config)
+			cfg.MaxStale = time.Minute
+			cfg.HeartbeatInterval = 10 * time.Second
+			cfg.StalenessClock = tt.stalenessClock
+			clock := tracking.NewManualClock(time.Unix(1000, 0))
+			p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), next, tracking.WithClock(clock))
+			clock.BlockUntil(1)
+
+			value := int64(5)
+			batch := goldenBatch{{Metric: "requests", Monotonic: true, Start: tt.pointTime - 10, Time: tt.pointTime, Int: &value}}
+			_, err := p.processMetrics(context.Background(), batch.metrics(t))
+			require.NoError(t, err)
+
+			// The series is quiet for a whole interval at the sweep at
+			// 1020s, the sweep at 1030s waits for it to complete
+			clock.Advance(30 * time.Second)
+			require.NoError(t, p.Shutdown(context.Background()))
+
+			got := next.AllMetrics()
+			require.NotEmpty(t, got)
+			require.Equal(t, 1, got[0].DataPointCount())
+			m := got[0].ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+			assert.Equal(t, "requests", m.Name())
+			assert.Equal(t, pdata.AggregationTemporalityDelta, m.Sum().AggregationTemporality())
+			dp := m.Sum().DataPoints().At(0)
+			assert.Equal(t, int64(0), dp.IntVal())
+			assert.Equal(t, pdata.Timestamp(tt.pointTime*1e9), dp.StartTimestamp())
+			assert.Equal(t, pdata.Timestamp((tt.pointTime+20)*1e9), dp.Timestamp())
+		})
+	}
+}
+
+func TestCumulativeToDeltaProcessor_FlushOnShutdown(t *testing.T) {
+	next := new(consumertest.MetricsSink)
+	cfg := createDefaultConfig().(*Config)
+	cfg.FlushInterval = time.Hour
+	mgp, err := createMetricsProcessor(context.Background(), componenttest.NewNopProcessorCreateSettings(), cfg, next)
+	require.NoError(t, err)
+	require.NoError(t, mgp.Start(context.Background(), componenttest.NewNopHost()))
+
+	require.NoError(t, mgp.ConsumeMetrics(context.Background(), generateTestMetrics(testMetric{
+		metricNames:  []string{"metric_1"},
+		metricValues: [][]float64{{100, 200, 500}},
+		isCumulative: []bool{true},
+	})))
+	got := next.AllMetrics()
+	require.Equal(t, 1, len(got))
+	assert.Equal(t, 0, got[0].MetricCount())
+
+	require.NoError(t, mgp.Shutdown(context.Background()))
+	got = next.AllMetrics()
+	require.Equal(t, 2, len(got))
+	require.Equal(t, 1, got[1].DataPointCount())
+	m := got[1].ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+	assert.Equal(t, "metric_1", m.Name())
+	assert.Equal(t, pdata.AggregationTemporalityDelta, m.Sum().AggregationTemporality())
+	assert.Equal(t, 500.0, m.Sum().DataPoints().At(0).DoubleVal())
+}
+
+func TestCumulativeToDeltaProcessor_DropEmpty(t *testing.T) {
+	tests := []struct {
+		dropEmpty     string
+		wantResources int
+		wantLibraries int
+		wantMetrics   int
+	}{
+		{dropEmpty: "none", wantResources: 1, wantLibraries: 1, wantMetrics: 1},
+		{dropEmpty: "metrics", wantResources: 1, wantLibraries: 1, wantMetrics: 0},
+		{dropEmpty: "libraries", wantResources: 1, wantLibraries: 0, wantMetrics: 0},
+		{dropEmpty: "resources", wantResources: 0, wantLibraries: 0, wantMetrics: 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.dropEmpty, func(t *testing.T) {
+			cfg := createDefaultConfig().(*Config)
+			cfg.MonotonicOnly = false
+			cfg.DropEmpty = test.dropEmpty
+			p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), consumertest.NewNop())
+
+			// The first point of a non monotonic sum is dropped
+			md := generateTestMetrics(testMetric{
+				metricNames:  []string{"metric_1"},
+				metricValues: [][]float64{{100}},
+				isCumulative: []bool{true},
+			})
+			md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().SetIsMonotonic(false)
+
+			got, err := p.processMetrics(context.Background(), md)
+			require.NoError(t, err)
+			assert.Equal(t, 0, got.DataPointCount())
+			require.Equal(t, test.wantResources, got.ResourceMetrics().Len())
+			if test.wantResources == 0 {
+				return
+			}
+			ilms := got.ResourceMetrics().At(0).InstrumentationLibraryMetrics()
+			require.Equal(t, test.wantLibraries, ilms.Len())
+			if test.wantLibraries == 0 {
+				return
+			}
+			assert.Equal(t, test.wantMetrics, ilms.At(0).Metrics().Len())
+		})
+	}
+}
+
+func TestCumulativeToDeltaProcessor_Wraparound(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Rules = []RuleConfig{
+		{Metrics: []string{"metric_1"}, Wraparound: "32bit"},
+		{Metrics: []string{"metric_1", "metric_2"}, Wraparound: "none"},
+	}
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), consumertest.NewNop())
+
+	convert := func(value float64) pdata.MetricSlice {
+		md := generateTestMetrics(testMetric{
+			metricNames:  []string{"metric_1", "metric_2"},
+			metricValues: [][]float64{{value}, {value}},
+			isCumulative: []bool{true, true},
+		})
+		got, err := p.processMetrics(context.Background(), md)
+		require.NoError(t, err)
+		return got.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	}
+
+	convert(math.MaxUint32 - 10)
+	ms := convert(5)
+	// metric_1 wrapped around, metric_2 was reset
+	assert.Equal(t, 16.0, ms.At(0).Sum().DataPoints().At(0).DoubleVal())
+	assert.Equal(t, 5.0, ms.At(1).Sum().DataPoints().At(0).DoubleVal())
+}
+
+func TestCumulativeToDeltaProcessor_InvalidValues(t *testing.T) {
+	registerMetricViews(t)
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProcessorSettings = config.NewProcessorSettings(config.NewIDWithName(typeStr, "invalid"))
+	cfg.Rules = []RuleConfig{{Metrics: []string{"metric_1"}, InvalidValues: "flag"}}
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), consumertest.NewNop())
+
+	var ms pdata.MetricSlice
+	for _, value := range []float64{1, math.Inf(1)} {
+		md := generateTestMetrics(testMetric{
+			metricNames:  []string{"metric_1", "metric_2"},
+			metricValues: [][]float64{{value}, {value}},
+			isCumulative: []bool{true, true},
+		})
+		got, err := p.processMetrics(context.Background(), md)
+		require.NoError(t, err)
+		ms = got.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	}
+
+	// metric_1 passes the delta on flagged, metric_2 drops it
+	require.Equal(t, 1, ms.Len())
+	assert.Equal(t, "metric_1", ms.At(0).Name())
+	dp := ms.At(0).Sum().DataPoints().At(0)
+	assert.True(t, math.IsInf(dp.DoubleVal(), 1))
+	flag, ok := dp.Attributes().Get(flagAttribute)
+	require.True(t, ok)
+	assert.Equal(t, "non_finite", flag.StringVal())
+
+	processorTag := tag.Tag{Key: processorTagKey, Value: "cumulativetodelta/invalid"}
+	assert.Equal(t, 2.0, viewValue(t, "events", processorTag, tag.Tag{Key: eventTagKey, Value: "non_finite"}))
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestCumulativeToDeltaProcessor_GapSpread(t *testing.T) {
+	next := new(consumertest.MetricsSink)
+	cfg := createDefaultConfig().(*Config)
+	cfg.MaxGap = time.Minute
+	cfg.GapAction = "spread"
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), next)
+
+	convert := func(ts time.Duration, value float64) pdata.Metrics {
+		md := generateTestMetrics(testMetric{
+			metricNames:  []string{"metric_1"},
+			metricValues: [][]float64{{value}},
+			isCumulative: []bool{true},
+		})
+		dp := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0)
+		dp.SetStartTimestamp(pdata.TimestampFromTime(time.Unix(0, 0)))
+		dp.SetTimestamp(pdata.TimestampFromTime(time.Unix(0, 0).Add(ts)))
+		got, err := p.processMetrics(context.Background(), md)
+		require.NoError(t, err)
+		return got
+	}
+	convert(time.Minute, 10)
+	got := convert(5*time.Minute, 50)
+
+	// The first three minutes of the gap are sent separately, the last one
+	// replaces the point
+	require.Equal(t, 1, len(next.AllMetrics()))
+	parts := next.AllMetrics()[0].ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints()
+	require.Equal(t, 3, parts.Len())
+	for i := 0; i < parts.Len(); i++ {
+		assert.Equal(t, 10.0, parts.At(i).DoubleVal())
+		assert.Equal(t, time.Minute, parts.At(i).Timestamp().AsTime().Sub(parts.At(i).StartTimestamp().AsTime()))
+	}
+	dp := got.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0)
+	assert.Equal(t, 10.0, dp.DoubleVal())
+	assert.Equal(t, pdata.TimestampFromTime(time.Unix(0, 0).Add(4*time.Minute)), dp.StartTimestamp())
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestCumulativeToDeltaProcessor_GaugeOutput(t *testing.T) {
+	registerMetricViews(t)
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProcessorSettings = config.NewProcessorSettings(config.NewIDWithName(typeStr, "gauge"))
+	cfg.MonotonicOnly = false
+	cfg.NonMonotonicOutput = "gauge"
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), consumertest.NewNop())
+
+	md := generateTestMetrics(testMetric{
+		metricNames:  []string{"metric_1"},
+		metricValues: [][]float64{{10, 5}},
+		isCumulative: []bool{true},
+	})
+	m := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+	m.Sum().SetIsMonotonic(false)
+	for i := 0; i < m.Sum().DataPoints().Len(); i++ {
+		m.Sum().DataPoints().At(i).SetStartTimestamp(pdata.TimestampFromTime(time.Unix(0, 0).Add(time.Second)))
+	}
+	got, err := p.processMetrics(context.Background(), md)
+	require.NoError(t, err)
+
+	m = got.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0)
+	require.Equal(t, pdata.MetricDataTypeGauge, m.DataType())
+	require.Equal(t, 2, m.Gauge().DataPoints().Len())
+	assert.Equal(t, 10.0, m.Gauge().DataPoints().At(0).DoubleVal())
+	assert.Equal(t, 5.0, m.Gauge().DataPoints().At(1).DoubleVal())
+	// Gauge points have no start timestamp
+	assert.Zero(t, m.Gauge().DataPoints().At(0).StartTimestamp())
+	assert.Zero(t, m.Gauge().DataPoints().At(1).StartTimestamp())
+	assert.Empty(t, p.deltaCalculator.States())
+
+	processorTag := tag.Tag{Key: processorTagKey, Value: "cumulativetodelta/gauge"}
+	modeTag := tag.Tag{Key: modeTagKey, Value: "convert"}
+	assert.Equal(t, 2.0, viewValue(t, "points_gauge", processorTag, modeTag))
+	assert.Equal(t, 0.0, viewValue(t, "points_converted", processorTag, modeTag))
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestCumulativeToDeltaProcessor_Shadow(t *testing.T) {
+	registerMetricViews(t)
+	next := new(consumertest.MetricsSink)
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProcessorSettings = config.NewProcessorSettings(config.NewIDWithName(typeStr, "shadow"))
+	cfg.Mode = "shadow"
+	cfg.MaxStale = time.Minute
+	cfg.HeartbeatInterval = time.Minute
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), next)
+
+	// Converted, reset and converted again
+	for _, value := range []float64{100, 50, 80} {
+		md := generateTestMetrics(testMetric{
+			metricNames:  []string{"metric_1"},
+			metricValues: [][]float64{{value}},
+			isCumulative: []bool{true},
+		})
+		want := md.Clone()
+		got, err := p.processMetrics(context.Background(), md)
+		require.NoError(t, err)
+		assert.Equal(t, want, got)
+	}
+
+	// Heartbeats are recorded, not sent
+	p.exportDeltas([]tracking.DeltaPoint{{Identity: tracking.MetricIdentity{MetricValueType: pdata.MetricValueTypeDouble}}})
+	assert.Empty(t, next.AllMetrics())
+
+	processorTag := tag.Tag{Key: processorTagKey, Value: "cumulativetodelta/shadow"}
+	modeTag := tag.Tag{Key: modeTagKey, Value: "shadow"}
+	assert.Equal(t, 3.0, viewValue(t, "points_converted", processorTag, modeTag))
+	assert.Equal(t, 0.0, viewValue(t, "points_dropped", processorTag, modeTag))
+	assert.Equal(t, 1.0, viewValue(t, "events", processorTag, modeTag, tag.Tag{Key: eventTagKey, Value: "counter_reset"}))
+	assert.Equal(t, 4.0, viewValue(t, "delta_value", processorTag, modeTag))
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestCumulativeToDeltaProcessor_DeferredPoints(t *testing.T) {
+	registerMetricViews(t)
+	cfg := createDefaultConfig().(*Config)
+	cfg.ProcessorSettings = config.NewProcessorSettings(config.NewIDWithName(typeStr, "deferred"))
+	cfg.FlushInterval = time.Hour
+	p := newCumulativeToDeltaProcessor(cfg, zap.NewNop(), consumertest.NewNop())
+
+	// Accumulated points are deferred, not dropped
+	for _, value := range []float64{100, 150} {
+		_, err := p.processMetrics(context.Background(), generateTestMetrics(testMetric{
+			metricNames:  []string{"metric_1"},
+			metricValues: [][]float64{{value}},
+			isCumulative: []bool{true},
+		}))
+		require.NoError(t, err)
+	}
+
+	processorTag := tag.Tag{Key: processorTagKey, Value: "cumulativetodelta/deferred"}
+	modeTag := tag.Tag{Key: modeTagKey, Value: "convert"}
+	assert.Equal(t, 2.0, viewValue(t, "points_deferred", processorTag, modeTag))
+	assert.Equal(t, 0.0, viewValue(t, "points_dropped", processorTag, modeTag))
+	require.NoError(t, p.Shutdown(context.Background()))
+}
+
+func TestNewEventLogger_Sampling(t *testing.T) {
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger, level := newEventLogger(zap.New(core), LoggingConfig{
+		Level:              "warn",
+		SamplingInitial:    2,
+		SamplingThereafter: 1000,
+		SamplingTick:       time.Hour,
+	})
+	assert.Equal(t, zapcore.WarnLevel, level)
+
+	for i := 0; i < 100; i++ {
+		logger.Warn("counter reset")
+	}
+	logger.Warn("out of order point")
+	assert.Equal(t, 2, logs.FilterMessage("counter reset").Len())
+	assert.Equal(t, 1, logs.FilterMessage("out of order point").Len())
+}
+
 func BenchmarkConsumeMetrics(b *testing.B) {
 	c := consumertest.NewNop()
 	params := component.ProcessorCreateSettings{
@@ -0,0 +1,124 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"math"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+// WithAlignment splits each delta proportionally across buckets of the
+// given width, aligned to the epoch. Convert returns the last bucket the
+// delta completes, the earlier ones are emitted through fn. The part of a
+// delta in a bucket it doesn't complete is carried over to the next delta
+// of the series, and nothing is returned until a bucket is complete. The
+// carried part is emitted through fn as is on Flush, and when the series
+// is removed as stale.
+func WithAlignment(bucket time.Duration, fn DeltaFunc) Option {
+	return func(t *metricTracker) {
+		t.alignment = bucket
+		t.alignFunc = fn
+	}
+}
+
+// bucket is the part of the deltas of a series in a bucket not completed
+// yet. Its value starts at the start of the bucket.
+type bucket struct {
+	value   DeltaValue
+	pending bool
+}
+
+// split splits delta, ending at timestamp, across the buckets of width it
+// covers, adding the carried part to its bucket. It returns the buckets
+// completed, and carries the part in the last bucket when it isn't. At
+// most maxSpreadParts buckets are completed, a delta covering more is
+// split across the last ones.
+func (b *bucket) split(id MetricIdentity, width time.Duration, delta DeltaValue, timestamp pdata.Timestamp) []DeltaPoint {
+	w := pdata.Timestamp(width)
+	var out []DeltaPoint
+	start := delta.StartTimestamp
+	if limit := (timestamp/w - maxSpreadParts) * w; timestamp/w > maxSpreadParts && start < limit {
+		start = limit
+	}
+	first := start / w * w
+	if b.pending && b.value.StartTimestamp < first {
+		// The carried bucket ended before the delta started
+		out = append(out, DeltaPoint{Identity: id, Value: b.value, Timestamp: b.value.StartTimestamp + w})
+		b.pending = false
+	}
+
+	total := float64(timestamp - start)
+	var intSplit int64
+	var floatSplit float64
+	for edge := first; edge < timestamp; edge += w {
+		end := edge + w
+		part := DeltaValue{StartTimestamp: edge, Flag: delta.Flag}
+		if end >= timestamp {
+			// The last part takes the remainder
+			part.IntValue = delta.IntValue - intSplit
+			part.FloatValue = delta.FloatValue - floatSplit
+		} else {
+			share := float64(end-start) / total
+			part.IntValue = int64(math.Round(float64(delta.IntValue)*share)) - intSplit
+			part.FloatValue = delta.FloatValue*share - floatSplit
+			intSplit += part.IntValue
+			floatSplit += part.FloatValue
+		}
+		if b.pending && b.value.StartTimestamp == edge {
+			part.IntValue += b.value.IntValue
+			part.FloatValue += b.value.FloatValue
+			if part.Flag == FlagNone {
+				part.Flag = b.value.Flag
+			}
+			b.pending = false
+		}
+		if end > timestamp {
+			b.value = part
+			b.pending = true
+			break
+		}
+		out = append(out, DeltaPoint{Identity: id, Value: part, Timestamp: end})
+	}
+	return out
+}
+
+// takeBucket returns the carried part of the deltas of the state, if any,
+// as a delta ending at the end of its bucket, and clears it.
+func (s *State) takeBucket(width time.Duration) (DeltaPoint, bool) {
+	if !s.bucket.pending {
+		return DeltaPoint{}, false
+	}
+	s.bucket.pending = false
+	return DeltaPoint{
+		Identity:  s.Identity,
+		Value:     s.bucket.value,
+		Timestamp: s.bucket.value.StartTimestamp + pdata.Timestamp(width),
+	}, true
+}
+
+// align splits delta of the locked state across the buckets it covers. It
+// returns the last bucket completed, if any, and the earlier ones.
+func (t *metricTracker) align(state *State, delta DeltaValue, timestamp pdata.Timestamp) (out DeltaValue, valid bool, earlier []DeltaPoint) {
+	buckets := state.bucket.split(state.Identity, t.alignment, delta, timestamp)
+	if len(buckets) == 0 {
+		return DeltaValue{Deferred: true}, false, nil
+	}
+	last := buckets[len(buckets)-1]
+	out = last.Value
+	out.EndTimestamp = last.Timestamp
+	return out, true, buckets[:len(buckets)-1]
+}
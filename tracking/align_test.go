@@ -0,0 +1,151 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestMetricTracker_Alignment(t *testing.T) {
+	sec := pdata.Timestamp(time.Second)
+	var emitted []DeltaPoint
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithAlignment(time.Minute, func(points []DeltaPoint) {
+		emitted = append(emitted, points...)
+	}))
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 45 * sec
+
+	bucket := func(start, value int64) DeltaValue {
+		return DeltaValue{StartTimestamp: pdata.Timestamp(start) * sec, IntValue: value, EndTimestamp: pdata.Timestamp(start+60) * sec}
+	}
+	tests := []struct {
+		name        string
+		timestamp   pdata.Timestamp
+		value       int64
+		wantValid   bool
+		wantDelta   DeltaValue
+		wantEmitted []int64
+	}{
+		{
+			name:      "First delta completes its first bucket",
+			timestamp: 75 * sec,
+			value:     30,
+			wantValid: true,
+			wantDelta: bucket(0, 15),
+		},
+		{
+			name:      "Delta within a bucket is carried",
+			timestamp: 90 * sec,
+			value:     60,
+		},
+		{
+			name:        "Delta completing several buckets",
+			timestamp:   210 * sec,
+			value:       180,
+			wantValid:   true,
+			wantDelta:   bucket(120, 60),
+			wantEmitted: []int64{75},
+		},
+		{
+			name:      "Delta ending at a bucket edge",
+			timestamp: 240 * sec,
+			value:     200,
+			wantValid: true,
+			wantDelta: bucket(180, 50),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			emitted = nil
+			out, valid := tr.Convert(MetricPoint{
+				Identity: id,
+				Value:    ValuePoint{ObservedTimestamp: tt.timestamp, IntValue: tt.value},
+			})
+			if valid != tt.wantValid || valid && out != tt.wantDelta {
+				t.Errorf("MetricTracker.Convert() = %v, %v, want %v, %v", out, valid, tt.wantDelta, tt.wantValid)
+			}
+			var values []int64
+			for _, p := range emitted {
+				if p.Timestamp-p.Value.StartTimestamp != 60*sec || p.Value.StartTimestamp%(60*sec) != 0 {
+					t.Errorf("Emitted bucket %v doesn't start and end at bucket edges", p)
+				}
+				values = append(values, p.Value.IntValue)
+			}
+			if !reflect.DeepEqual(values, tt.wantEmitted) {
+				t.Errorf("Emitted buckets of %v, want %v", values, tt.wantEmitted)
+			}
+		})
+	}
+}
+
+func TestMetricTracker_AlignmentLimit(t *testing.T) {
+	sec := pdata.Timestamp(time.Second)
+	var emitted []DeltaPoint
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithAlignment(time.Second, func(points []DeltaPoint) {
+		emitted = append(emitted, points...)
+	}))
+	id := newSumIdentity(true, pdata.MetricValueTypeDouble)
+	id.StartTimestamp = 1000 * sec
+
+	out, valid := tr.Convert(MetricPoint{
+		Identity: id,
+		Value:    ValuePoint{ObservedTimestamp: 3000 * sec, FloatValue: 2000},
+	})
+	if !valid || len(emitted) != maxSpreadParts-1 {
+		t.Fatalf("MetricTracker.Convert() = %v, %v with %d buckets emitted, want %d buckets", out, valid, len(emitted), maxSpreadParts)
+	}
+	if emitted[0].Value.StartTimestamp != 2000*sec || emitted[0].Value.FloatValue != 2 || out.FloatValue != 2 {
+		t.Errorf("First bucket %v and last bucket %v, want the delta split across the last %d seconds", emitted[0], out, maxSpreadParts)
+	}
+}
+
+func TestMetricTracker_AlignmentTotal(t *testing.T) {
+	sec := pdata.Timestamp(time.Second)
+	var emitted []DeltaPoint
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithAlignment(time.Minute, func(points []DeltaPoint) {
+		emitted = append(emitted, points...)
+	}))
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 30 * sec
+
+	var total int64
+	for i, value := range []int64{45, 70, 170, 215} {
+		out, valid := tr.Convert(MetricPoint{
+			Identity: id,
+			Value:    ValuePoint{ObservedTimestamp: pdata.Timestamp(75+40*i) * sec, IntValue: value},
+		})
+		if valid {
+			total += out.IntValue
+		}
+	}
+	// The carried part is emitted on Flush, nothing is lost
+	tr.Flush()
+	for _, p := range emitted {
+		total += p.Value.IntValue
+	}
+	if total != 215 {
+		t.Errorf("Total of the aligned deltas = %d, want 215", total)
+	}
+	last := emitted[len(emitted)-1]
+	if last.Value.StartTimestamp%(60*sec) != 0 || last.Timestamp-last.Value.StartTimestamp != 60*sec {
+		t.Errorf("Flushed bucket %v doesn't start and end at bucket edges", last)
+	}
+}
@@ -0,0 +1,163 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock provides the tracker with the current time and with tickers for
+// its background work.
+type Clock interface {
+	Now() time.Time
+	NewTicker(d time.Duration) Ticker
+}
+
+// Ticker delivers the ticks of a Clock.
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// WithClock replaces the wall clock used by the tracker.
+func WithClock(clock Clock) Option {
+	return func(t *metricTracker) {
+		t.clock = clock
+	}
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTicker(d time.Duration) Ticker {
+	return realTicker{time.NewTicker(d)}
+}
+
+type realTicker struct {
+	*time.Ticker
+}
+
+func (t realTicker) C() <-chan time.Time {
+	return t.Ticker.C
+}
+
+// ManualClock is a Clock which only moves when advanced, so that tests
+// can step the tracker through time deterministically.
+type ManualClock struct {
+	mu      sync.Mutex
+	cond    *sync.Cond
+	now     time.Time
+	tickers []*manualTicker
+}
+
+// NewManualClock returns a ManualClock set to now.
+func NewManualClock(now time.Time) *ManualClock {
+	c := &ManualClock{now: now}
+	c.cond = sync.NewCond(&c.mu)
+	return c
+}
+
+func (c *ManualClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *ManualClock) NewTicker(d time.Duration) Ticker {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &manualTicker{
+		c:       make(chan time.Time),
+		stopped: make(chan struct{}),
+		period:  d,
+		next:    c.now.Add(d),
+	}
+	c.tickers = append(c.tickers, t)
+	c.cond.Broadcast()
+	return t
+}
+
+// BlockUntil waits until n tickers were created, so that the background
+// work they drive is in place before the clock is advanced.
+func (c *ManualClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for len(c.tickers) < n {
+		c.cond.Wait()
+	}
+}
+
+// Advance moves the clock forward by d and delivers the ticks which became
+// due, in order. It returns once every tick was received. The receiver
+// handles a tick before it receives the next one, so the effects of a tick
+// are visible once a following tick was delivered.
+func (c *ManualClock) Advance(d time.Duration) {
+	type tick struct {
+		ticker *manualTicker
+		time   time.Time
+	}
+
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	var due []tick
+	for _, t := range c.tickers {
+		if t.isStopped() {
+			continue
+		}
+		for !t.next.After(c.now) {
+			due = append(due, tick{ticker: t, time: t.next})
+			t.next = t.next.Add(t.period)
+		}
+	}
+	c.mu.Unlock()
+
+	for _, tick := range due {
+		select {
+		case tick.ticker.c <- tick.time:
+		case <-tick.ticker.stopped:
+		}
+	}
+}
+
+type manualTicker struct {
+	c        chan time.Time
+	stopped  chan struct{}
+	stopOnce sync.Once
+	period   time.Duration
+	next     time.Time
+}
+
+func (t *manualTicker) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *manualTicker) Stop() {
+	t.stopOnce.Do(func() {
+		close(t.stopped)
+	})
+}
+
+func (t *manualTicker) isStopped() bool {
+	select {
+	case <-t.stopped:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build go1.18
+// +build go1.18
+
+package tracking
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// decodeSeries returns the timestamps and values encoded in data, eight
+// bytes each.
+func decodeSeries(data []byte) ([]pdata.Timestamp, []uint64) {
+	var timestamps []pdata.Timestamp
+	var values []uint64
+	for len(data) >= 10 {
+		timestamps = append(timestamps, pdata.Timestamp(binary.LittleEndian.Uint16(data)))
+		values = append(values, binary.LittleEndian.Uint64(data[2:]))
+		data = data[10:]
+	}
+	return timestamps, values
+}
+
+func FuzzMetricTracker_Convert(f *testing.F) {
+	encode := func(points ...uint64) []byte {
+		b := make([]byte, 10*len(points))
+		for i, p := range points {
+			binary.LittleEndian.PutUint16(b[10*i:], uint16(i+1))
+			binary.LittleEndian.PutUint64(b[10*i+2:], p)
+		}
+		return b
+	}
+	f.Add(true, false, uint8(InvalidFlag), encode(10, 20, 5, 30))
+	f.Add(false, false, uint8(InvalidFlag), encode(10, uint64(1<<63), 5))
+	f.Add(false, false, uint8(InvalidDrop), encode(10, uint64(1<<63), 5))
+	f.Add(true, true, uint8(InvalidDrop), encode(math.Float64bits(1.5), math.Float64bits(math.NaN()), math.Float64bits(math.Inf(1))))
+	f.Add(false, true, uint8(InvalidReset), encode(math.Float64bits(-1), math.Float64bits(2), math.Float64bits(math.Inf(-1))))
+
+	f.Fuzz(func(t *testing.T, monotonic, float bool, action uint8, data []byte) {
+		policy := Policy{InvalidValues: InvalidAction(action % 3)}
+		valueType := pdata.MetricValueTypeInt
+		if float {
+			valueType = pdata.MetricValueTypeDouble
+		}
+		id := newSumIdentity(monotonic, valueType)
+		tr := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+
+		timestamps, values := decodeSeries(data)
+		var first, last int64
+		var sum int64
+		var converted int
+		for i, ts := range timestamps {
+			point := ValuePoint{ObservedTimestamp: ts, IntValue: int64(values[i]), FloatValue: math.Float64frombits(values[i])}
+			out, valid := tr.Convert(MetricPoint{Identity: id, Value: point, Policy: policy})
+			if float && math.IsNaN(point.FloatValue) && valid {
+				t.Fatalf("Convert() of NaN is valid")
+			}
+			if valid && out.StartTimestamp >= ts {
+				t.Fatalf("Convert() at %v = %+v, want a start before the point", ts, out)
+			}
+			if valid && policy.InvalidValues != InvalidFlag && (out.Flag != FlagNone || math.IsInf(out.FloatValue, 0)) {
+				t.Fatalf("Convert() = %+v, want a finite unflagged delta", out)
+			}
+			if !valid {
+				continue
+			}
+			if converted == 0 {
+				first = point.IntValue
+			} else {
+				sum += out.IntValue
+			}
+			last = point.IntValue
+			converted++
+		}
+
+		// Without resets, integer deltas add up to the change of the
+		// cumulative value when overflowing deltas are passed on.
+		if !float && !monotonic && policy.InvalidValues == InvalidFlag && converted > 0 && sum != last-first {
+			t.Errorf("sum of deltas = %d, want %d", sum, last-first)
+		}
+	})
+}
+
+// fuzzIdentity returns an identity built from the NUL separated fields of
+// s, along with a description which is equal for equal identities. Empty
+// attribute keys leave the attribute out, and intAttr makes the point
+// attribute an integer when its value is one.
+func fuzzIdentity(s string, intAttr bool) (MetricIdentity, string) {
+	f := strings.SplitN(s, "\x00", 8)
+	for len(f) < 8 {
+		f = append(f, "")
+	}
+	resKey, resValue, lib, version, name, unit, key, value := f[0], f[1], f[2], f[3], f[4], f[5], f[6], f[7]
+
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	if resKey != "" {
+		id.Resource.Attributes().InsertString(resKey, resValue)
+	} else {
+		resValue = ""
+	}
+	id.InstrumentationLibrary.SetName(lib)
+	id.InstrumentationLibrary.SetVersion(version)
+	id.MetricName = name
+	id.MetricUnit = unit
+	switch n, err := strconv.ParseInt(value, 10, 64); {
+	case key == "":
+		value, intAttr = "", false
+	case intAttr && err == nil:
+		id.Attributes.InsertInt(key, n)
+		value = strconv.FormatInt(n, 10)
+	default:
+		id.Attributes.InsertString(key, value)
+		intAttr = false
+	}
+	return id, fmt.Sprintf("%q %v", []string{resKey, resValue, lib, version, name, unit, key, value}, intAttr)
+}
+
+func FuzzMetricIdentity_Write(f *testing.F) {
+	f.Add("\x00\x00\x00\x00\x00\x00a:b\x00c", false, "\x00\x00\x00\x00\x00\x00a\x00b:c", false)
+	f.Add("\x00\x00\x00\x00\x00\x00a\x001", false, "\x00\x00\x00\x00\x00\x00a\x001", true)
+	f.Add("x\x001", false, "\x00\x00x:1", false)
+	f.Add("\x00\x00\x00\x00\x00u\x1ea:b", false, "\x00\x00\x00\x00\x00u\x00a\x00b", false)
+	f.Add("\x00\x00\x00\x00m\x1eN", false, "\x00\x00\x00N\x1em", false)
+
+	f.Fuzz(func(t *testing.T, a string, intA bool, b string, intB bool) {
+		idA, descA := fuzzIdentity(a, intA)
+		idB, descB := fuzzIdentity(b, intB)
+		bufA, bufB := &bytes.Buffer{}, &bytes.Buffer{}
+		idA.Write(bufA)
+		idB.Write(bufB)
+		if bufA.String() == bufB.String() && descA != descB {
+			t.Errorf("identities %s and %s have the same encoding %q", descA, descB, bufA.String())
+		}
+	})
+}
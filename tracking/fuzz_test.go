@@ -0,0 +1,60 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"testing"
+	"testing/quick"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// TestMetricTracker_MonotonicSumProperty checks that for a monotonic series
+// without resets, the deltas after the first point add up to the last
+// cumulative value minus the first.
+func TestMetricTracker_MonotonicSumProperty(t *testing.T) {
+	property := func(first uint32, increments []uint16, float bool) bool {
+		valueType := pdata.MetricValueTypeInt
+		if float {
+			valueType = pdata.MetricValueTypeDouble
+		}
+		id := newSumIdentity(true, valueType)
+		tr := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+
+		value := int64(first)
+		tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 1, IntValue: value, FloatValue: float64(value)}})
+		var sum int64
+		var sumFloat float64
+		for i, inc := range increments {
+			value += int64(inc)
+			ts := pdata.Timestamp(i + 2)
+			out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: ts, IntValue: value, FloatValue: float64(value)}})
+			if !valid || out.StartTimestamp != ts-1 {
+				return false
+			}
+			sum += out.IntValue
+			sumFloat += out.FloatValue
+		}
+		if float {
+			return sumFloat == float64(value-int64(first))
+		}
+		return sum == value-int64(first)
+	}
+	if err := quick.Check(property, nil); err != nil {
+		t.Error(err)
+	}
+}
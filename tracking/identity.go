@@ -17,6 +17,7 @@ package tracking
 import (
 	"bytes"
 	"strconv"
+	"strings"
 
 	"go.opentelemetry.io/collector/model/pdata"
 	tracetranslator "go.opentelemetry.io/collector/translator/trace"
@@ -38,22 +39,20 @@ const A = int32('A')
 const SEP = byte(0x1E)
 const SEPSTR = string(SEP)
 
+// Write writes the encoding of the identity to b, which differs for any
+// two different identities. Fields are separated by SEP, and an attribute
+// is written as its key and value separated by ':', followed by the type of
+// the value. Strings are escaped, so that they contain neither.
 func (mi *MetricIdentity) Write(b *bytes.Buffer) {
 	b.WriteRune(A + int32(mi.MetricDataType))
 	b.WriteByte(SEP)
 	b.WriteRune(A + int32(mi.MetricValueType))
-	mi.Resource.Attributes().Sort().Range(func(k string, v pdata.AttributeValue) bool {
-		b.WriteByte(SEP)
-		b.WriteString(k)
-		b.WriteByte(':')
-		b.WriteString(tracetranslator.AttributeValueToString(v))
-		return true
-	})
+	writeAttributes(b, mi.Resource.Attributes())
 
 	b.WriteByte(SEP)
-	b.WriteString(mi.InstrumentationLibrary.Name())
+	escaper.WriteString(b, mi.InstrumentationLibrary.Name())
 	b.WriteByte(SEP)
-	b.WriteString(mi.InstrumentationLibrary.Version())
+	escaper.WriteString(b, mi.InstrumentationLibrary.Version())
 	b.WriteByte(SEP)
 	if mi.MetricIsMonotonic {
 		b.WriteByte('Y')
@@ -62,19 +61,43 @@ func (mi *MetricIdentity) Write(b *bytes.Buffer) {
 	}
 
 	b.WriteByte(SEP)
-	b.WriteString(mi.MetricName)
+	escaper.WriteString(b, mi.MetricName)
 	b.WriteByte(SEP)
-	b.WriteString(mi.MetricUnit)
+	escaper.WriteString(b, mi.MetricUnit)
+
+	writeAttributes(b, mi.Attributes)
+	b.WriteByte(SEP)
+	b.WriteString(strconv.FormatInt(int64(mi.StartTimestamp), 36))
+}
+
+// escaper escapes SEP and ':' in strings, and the escape character itself.
+var escaper = strings.NewReplacer("\x1b", "\x1b\x1b", SEPSTR, "\x1bs", ":", "\x1bc")
 
-	mi.Attributes.Sort().Range(func(k string, v pdata.AttributeValue) bool {
+func writeAttributes(b *bytes.Buffer, attrs pdata.AttributeMap) {
+	attrs.Sort().Range(func(k string, v pdata.AttributeValue) bool {
 		b.WriteByte(SEP)
-		b.WriteString(k)
+		escaper.WriteString(b, k)
 		b.WriteByte(':')
-		b.WriteString(tracetranslator.AttributeValueToString(v))
+		escaper.WriteString(b, tracetranslator.AttributeValueToString(v))
+		b.WriteByte(SEP)
+		b.WriteRune(A + int32(v.Type()))
 		return true
 	})
-	b.WriteByte(SEP)
-	b.WriteString(strconv.FormatInt(int64(mi.StartTimestamp), 36))
+}
+
+// Clone returns a copy of the identity which owns its resource,
+// instrumentation library and attributes. Tracked state holds clones so a
+// long lived series doesn't keep the batch it was first seen in from being
+// garbage collected.
+func (mi *MetricIdentity) Clone() MetricIdentity {
+	out := *mi
+	out.Resource = pdata.NewResource()
+	mi.Resource.CopyTo(out.Resource)
+	out.InstrumentationLibrary = pdata.NewInstrumentationLibrary()
+	mi.InstrumentationLibrary.CopyTo(out.InstrumentationLibrary)
+	out.Attributes = pdata.NewAttributeMap()
+	mi.Attributes.CopyTo(out.Attributes)
+	return out
 }
 
 func (mi *MetricIdentity) IsFloatVal() bool {
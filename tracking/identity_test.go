@@ -101,6 +101,39 @@ func TestMetricIdentity_Write(t *testing.T) {
 	}
 }
 
+func TestMetricIdentity_Clone(t *testing.T) {
+	resource := pdata.NewResource()
+	resource.Attributes().InsertString("resource", "a")
+	il := pdata.NewInstrumentationLibrary()
+	il.SetName("ilm_name")
+	attributes := pdata.NewAttributeMap()
+	attributes.InsertString("label", "a")
+	mi := MetricIdentity{
+		Resource:               resource,
+		InstrumentationLibrary: il,
+		MetricDataType:         pdata.MetricDataTypeSum,
+		MetricName:             "m_name",
+		Attributes:             attributes,
+	}
+
+	clone := mi.Clone()
+	want, got := &bytes.Buffer{}, &bytes.Buffer{}
+	mi.Write(want)
+	clone.Write(got)
+	if got.String() != want.String() {
+		t.Errorf("MetricIdentity.Clone() = %q, want %q", got.String(), want.String())
+	}
+
+	resource.Attributes().UpdateString("resource", "b")
+	il.SetName("other")
+	attributes.UpdateString("label", "b")
+	got.Reset()
+	clone.Write(got)
+	if got.String() != want.String() {
+		t.Errorf("MetricIdentity.Clone() shares memory with the original: %q, want %q", got.String(), want.String())
+	}
+}
+
 func TestMetricIdentity_IsFloatVal(t *testing.T) {
 	type fields struct {
 		MetricValueType pdata.MetricValueType
@@ -0,0 +1,134 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	tracetranslator "go.opentelemetry.io/collector/translator/trace"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Event is a notable occurrence while converting a point.
+type Event int
+
+const (
+	EventCounterReset Event = iota
+	EventCounterWraparound
+	EventOutOfOrder
+	EventFirstDropped
+	EventNaNSkipped
+	EventOverflow
+	EventNonFinite
+	EventGap
+	EventOutlier
+	EventInferredMonotonic
+	EventInferredNonMonotonic
+	EventUnspecified
+)
+
+var eventNames = [...]string{
+	EventCounterReset:         "counter_reset",
+	EventCounterWraparound:    "counter_wraparound",
+	EventOutOfOrder:           "out_of_order",
+	EventFirstDropped:         "first_dropped",
+	EventNaNSkipped:           "nan_skipped",
+	EventOverflow:             "overflow",
+	EventNonFinite:            "non_finite",
+	EventGap:                  "gap",
+	EventOutlier:              "outlier",
+	EventInferredMonotonic:    "inferred_monotonic",
+	EventInferredNonMonotonic: "inferred_non_monotonic",
+	EventUnspecified:          "unspecified_cumulative",
+}
+
+var eventMessages = [...]string{
+	EventCounterReset:         "counter reset",
+	EventCounterWraparound:    "counter wraparound",
+	EventOutOfOrder:           "out of order point",
+	EventFirstDropped:         "dropping first observation",
+	EventNaNSkipped:           "skipping NaN value",
+	EventOverflow:             "delta overflow",
+	EventNonFinite:            "infinite value",
+	EventGap:                  "gap between points",
+	EventOutlier:              "implausible delta",
+	EventInferredMonotonic:    "inferred monotonic",
+	EventInferredNonMonotonic: "inferred non monotonic",
+	EventUnspecified:          "converting unspecified temporality as cumulative",
+}
+
+func (e Event) String() string {
+	return eventNames[e]
+}
+
+// EventFunc is called for every event while converting a point. It must
+// not call back into the tracker.
+type EventFunc func(Event)
+
+// WithEventFunc reports every event to fn, for example to count them.
+func WithEventFunc(fn EventFunc) Option {
+	return func(t *metricTracker) {
+		t.eventFunc = fn
+	}
+}
+
+// WithEventLogger logs every event, such as counter resets or out of order
+// points, to logger at level. Sampling, if any, is left to the logger.
+func WithEventLogger(logger *zap.Logger, level zapcore.Level) Option {
+	return func(t *metricTracker) {
+		t.events = logger
+		t.eventLevel = level
+	}
+}
+
+// logEvent reports event and logs it along with point of the series
+// identified by id, and the previous point of the series when known.
+func (t *metricTracker) logEvent(event Event, id MetricIdentity, point ValuePoint, prev *ValuePoint) {
+	if t.eventFunc != nil {
+		t.eventFunc(event)
+	}
+	if t.events == nil {
+		return
+	}
+	ce := t.events.Check(t.eventLevel, eventMessages[event])
+	if ce == nil {
+		return
+	}
+	fields := identityFields(id)
+	if prev != nil {
+		fields = append(fields, pointFields(id, "prev_", *prev)...)
+	}
+	fields = append(fields, pointFields(id, "", point)...)
+	ce.Write(fields...)
+}
+
+// identityFields describes the series identified by id in readable form.
+func identityFields(id MetricIdentity) []zap.Field {
+	return []zap.Field{
+		zap.String("metric", id.MetricName),
+		zap.Any("resource", tracetranslator.AttributeMapToMap(id.Resource.Attributes())),
+		zap.Any("attributes", tracetranslator.AttributeMapToMap(id.Attributes)),
+	}
+}
+
+func pointFields(id MetricIdentity, prefix string, point ValuePoint) []zap.Field {
+	value := zap.Int64(prefix+"value", point.IntValue)
+	if id.IsFloatVal() {
+		value = zap.Float64(prefix+"value", point.FloatValue)
+	}
+	return []zap.Field{
+		value,
+		zap.Time(prefix+"timestamp", point.ObservedTimestamp.AsTime()),
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestMetricTracker_EventLogging(t *testing.T) {
+	attributes := pdata.NewAttributeMap()
+	attributes.InsertString("host", "a")
+	monotonic := newSumIdentity(true, pdata.MetricValueTypeDouble)
+	monotonic.MetricName = "requests"
+	monotonic.Attributes = attributes
+	monotonic.StartTimestamp = 1
+	nonMonotonic := monotonic
+	nonMonotonic.MetricIsMonotonic = false
+
+	core, logs := observer.New(zapcore.DebugLevel)
+	var events []Event
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0,
+		WithEventLogger(zap.New(core), zapcore.InfoLevel),
+		WithEventFunc(func(event Event) {
+			events = append(events, event)
+		}))
+
+	tr.Convert(MetricPoint{Identity: monotonic, Value: ValuePoint{ObservedTimestamp: 20, FloatValue: 100}})
+	tr.Convert(MetricPoint{Identity: monotonic, Value: ValuePoint{ObservedTimestamp: 30, FloatValue: 10}})
+	tr.Convert(MetricPoint{Identity: monotonic, Value: ValuePoint{ObservedTimestamp: 25, FloatValue: 20}})
+	tr.Convert(MetricPoint{Identity: monotonic, Value: ValuePoint{ObservedTimestamp: 40, FloatValue: math.NaN()}})
+	tr.Convert(MetricPoint{Identity: nonMonotonic, Value: ValuePoint{ObservedTimestamp: 20, FloatValue: 5}})
+
+	wantEvents := []Event{EventCounterReset, EventOutOfOrder, EventNaNSkipped, EventFirstDropped}
+	if !reflect.DeepEqual(events, wantEvents) {
+		t.Errorf("reported events %v, want %v", events, wantEvents)
+	}
+
+	want := []string{"counter reset", "out of order point", "skipping NaN value", "dropping first observation"}
+	entries := logs.All()
+	if len(entries) != len(want) {
+		t.Fatalf("logged %d events, want %d: %v", len(entries), len(want), entries)
+	}
+	for i, entry := range entries {
+		if entry.Message != want[i] {
+			t.Errorf("event %d = %q, want %q", i, entry.Message, want[i])
+		}
+		if entry.Level != zapcore.InfoLevel {
+			t.Errorf("event %d level = %v, want info", i, entry.Level)
+		}
+		fields := entry.ContextMap()
+		if fields["metric"] != "requests" {
+			t.Errorf("event %d metric = %v, want requests", i, fields["metric"])
+		}
+		if attrs, ok := fields["attributes"].(map[string]interface{}); !ok || attrs["host"] != "a" {
+			t.Errorf("event %d attributes = %v, want host=a", i, fields["attributes"])
+		}
+	}
+
+	reset := entries[0].ContextMap()
+	if reset["prev_value"] != 100.0 || reset["value"] != 10.0 {
+		t.Errorf("counter reset values = %v -> %v, want 100 -> 10", reset["prev_value"], reset["value"])
+	}
+}
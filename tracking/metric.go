@@ -17,4 +17,8 @@ package tracking
 type MetricPoint struct {
 	Identity MetricIdentity
 	Value    ValuePoint
+	Policy   Policy
+	// UnspecifiedTemporality is set when the point is converted as
+	// cumulative although the temporality of its sum is unspecified.
+	UnspecifiedTemporality bool
 }
@@ -0,0 +1,101 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+// Monotonicity is the monotonicity of a series inferred from its values.
+type Monotonicity int
+
+const (
+	// MonotonicityUnknown is the monotonicity of a series which is not
+	// inferred, or not yet.
+	MonotonicityUnknown Monotonicity = iota
+	MonotonicityMonotonic
+	MonotonicityNonMonotonic
+)
+
+var monotonicityNames = [...]string{
+	MonotonicityUnknown:      "",
+	MonotonicityMonotonic:    "monotonic",
+	MonotonicityNonMonotonic: "non_monotonic",
+}
+
+func (m Monotonicity) String() string {
+	return monotonicityNames[m]
+}
+
+// WithMonotonicityInference infers the monotonicity of every series from
+// its first points, instead of trusting the monotonicity its producer
+// declares. A series is monotonic when its value didn't decrease over its
+// first points, and non monotonic otherwise. Until then, the declared
+// monotonicity applies.
+func WithMonotonicityInference(points int) Option {
+	return func(t *metricTracker) {
+		t.inferencePoints = points
+	}
+}
+
+// monotonicityInference infers the monotonicity of a series.
+type monotonicityInference struct {
+	points    int
+	decreased bool
+	inferred  Monotonicity
+}
+
+// infer records a point of the series of state, which decreased from the
+// previous one or not.
+func (t *metricTracker) infer(state *State, metricID MetricIdentity, metricPoint ValuePoint, decreased bool) {
+	inference := &state.inference
+	if t.inferencePoints <= 0 || inference.inferred != MonotonicityUnknown {
+		return
+	}
+	inference.points++
+	inference.decreased = inference.decreased || decreased
+	if inference.points < t.inferencePoints {
+		return
+	}
+
+	inference.inferred = MonotonicityMonotonic
+	if inference.decreased {
+		inference.inferred = MonotonicityNonMonotonic
+	}
+	switch {
+	case inference.inferred == MonotonicityMonotonic && !metricID.MetricIsMonotonic:
+		t.logEvent(EventInferredMonotonic, metricID, metricPoint, nil)
+	case inference.inferred == MonotonicityNonMonotonic && metricID.MetricIsMonotonic:
+		t.logEvent(EventInferredNonMonotonic, metricID, metricPoint, nil)
+	}
+}
+
+// isMonotonic reports whether the series of state is treated as monotonic.
+func (s *State) isMonotonic() bool {
+	switch s.inference.inferred {
+	case MonotonicityMonotonic:
+		return true
+	case MonotonicityNonMonotonic:
+		return false
+	}
+	return s.Identity.MetricIsMonotonic
+}
+
+func (t *metricTracker) Monotonic(id MetricIdentity) bool {
+	s, ok := t.states.Load(identityKey(id))
+	if !ok {
+		return id.MetricIsMonotonic
+	}
+	state := s.(*State)
+	state.Lock()
+	defer state.Unlock()
+	return state.isMonotonic()
+}
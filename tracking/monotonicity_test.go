@@ -0,0 +1,93 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestMetricTracker_MonotonicityInference(t *testing.T) {
+	type result struct {
+		valid bool
+		delta int64
+	}
+	tests := []struct {
+		name          string
+		monotonic     bool
+		values        []int64
+		want          []result
+		wantMonotonic bool
+		wantInferred  Monotonicity
+		wantEvents    []Event
+	}{
+		{
+			name:          "Counter declared non monotonic",
+			values:        []int64{1, 2, 3, 1},
+			want:          []result{{}, {true, 1}, {true, 1}, {true, 1}},
+			wantMonotonic: true,
+			wantInferred:  MonotonicityMonotonic,
+			wantEvents:    []Event{EventFirstDropped, EventInferredMonotonic, EventCounterReset},
+		},
+		{
+			name:          "Gauge declared monotonic",
+			monotonic:     true,
+			values:        []int64{5, 3, 4, 2},
+			want:          []result{{true, 5}, {true, 3}, {true, 1}, {true, -2}},
+			wantMonotonic: false,
+			wantInferred:  MonotonicityNonMonotonic,
+			wantEvents:    []Event{EventCounterReset, EventInferredNonMonotonic},
+		},
+		{
+			name:          "Counter declared monotonic",
+			monotonic:     true,
+			values:        []int64{5, 6, 7, 8},
+			want:          []result{{true, 5}, {true, 1}, {true, 1}, {true, 1}},
+			wantMonotonic: true,
+			wantInferred:  MonotonicityMonotonic,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []Event
+			tr := NewMetricTracker(context.Background(), zap.NewNop(), 0,
+				WithMonotonicityInference(3),
+				WithEventFunc(func(event Event) {
+					events = append(events, event)
+				}))
+			id := newSumIdentity(tt.monotonic, pdata.MetricValueTypeInt)
+			id.StartTimestamp = 1
+			for i, value := range tt.values {
+				out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: pdata.Timestamp(10 * (i + 1)), IntValue: value}})
+				if got := (result{valid, out.IntValue}); valid != tt.want[i].valid || valid && got != tt.want[i] {
+					t.Errorf("MetricTracker.Convert() of point %d = %v, want %v", i, got, tt.want[i])
+				}
+			}
+			if got := tr.Monotonic(id); got != tt.wantMonotonic {
+				t.Errorf("MetricTracker.Monotonic() = %v, want %v", got, tt.wantMonotonic)
+			}
+			if states := tr.States(); len(states) != 1 || states[0].Inferred != tt.wantInferred {
+				t.Errorf("MetricTracker.States() = %v, want a series inferred %v", states, tt.wantInferred)
+			}
+			if !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("reported events %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
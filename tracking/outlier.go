@@ -0,0 +1,100 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import "math"
+
+const (
+	// deltaAverageWeight is the weight of a new delta in the average.
+	deltaAverageWeight = 0.1
+	// deltaAverageWarmup is the number of deltas averaged before the
+	// average is used to tell outliers.
+	deltaAverageWarmup = 5
+)
+
+// deltaAverage is an exponentially weighted moving average of the
+// magnitude of non-zero deltas. Idle intervals are left out, so that the
+// first delta after them isn't taken for an outlier.
+type deltaAverage struct {
+	value   float64
+	samples int
+}
+
+func (a *deltaAverage) add(magnitude float64) {
+	if magnitude == 0 || math.IsInf(magnitude, 0) {
+		return
+	}
+	if a.samples == 0 {
+		a.value = magnitude
+	} else {
+		a.value += deltaAverageWeight * (magnitude - a.value)
+	}
+	a.samples++
+}
+
+// limit returns the largest plausible magnitude of a delta under policy,
+// and false when there is none.
+func (a *deltaAverage) limit(policy Policy) (float64, bool) {
+	limit, ok := policy.MaxDelta, policy.MaxDelta > 0
+	if policy.MaxDeltaFactor > 0 && a.samples >= deltaAverageWarmup {
+		if relative := policy.MaxDeltaFactor * a.value; !ok || relative < limit {
+			limit, ok = relative, true
+		}
+	}
+	return limit, ok
+}
+
+// checkOutlier handles out according to policy when it is implausibly
+// large for the series of state, and adds it to the average otherwise. It
+// returns false when out is dropped.
+func (t *metricTracker) checkOutlier(state *State, out *DeltaValue, metricID MetricIdentity, metricPoint ValuePoint, policy Policy) bool {
+	magnitude := math.Abs(out.FloatValue)
+	if !metricID.IsFloatVal() {
+		magnitude = math.Abs(float64(out.IntValue))
+	}
+	limit, ok := state.deltas.limit(policy)
+	if !ok || magnitude <= limit {
+		state.deltas.add(magnitude)
+		return true
+	}
+
+	t.logEvent(EventOutlier, metricID, metricPoint, nil)
+	switch policy.OutlierAction {
+	case OutlierClamp:
+		switch {
+		case metricID.IsFloatVal():
+			out.FloatValue = math.Copysign(limit, out.FloatValue)
+		case out.IntValue < 0:
+			out.IntValue = -intLimit(limit)
+		default:
+			out.IntValue = intLimit(limit)
+		}
+		return true
+	case OutlierFlag:
+		if out.Flag == FlagNone {
+			out.Flag = FlagOutlier
+		}
+		return true
+	}
+	return false
+}
+
+// intLimit returns limit truncated to an int64.
+func intLimit(limit float64) int64 {
+	if limit >= math.MaxInt64 {
+		return math.MaxInt64
+	}
+	return int64(limit)
+}
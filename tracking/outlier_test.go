@@ -0,0 +1,125 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"testing"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestMetricTracker_Outliers(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 1
+
+	tests := []struct {
+		name      string
+		policy    Policy
+		values    []int64
+		wantValid bool
+		wantDelta int64
+		wantFlag  Flag
+	}{
+		{
+			name:   "max_delta drops",
+			policy: Policy{MaxDelta: 1000},
+			values: []int64{0, 10, 20, 10020},
+		},
+		{
+			name:      "max_delta clamps",
+			policy:    Policy{MaxDelta: 1000, OutlierAction: OutlierClamp},
+			values:    []int64{0, 10, 20, 10020},
+			wantValid: true,
+			wantDelta: 1000,
+		},
+		{
+			name:      "max_delta_factor flags",
+			policy:    Policy{MaxDeltaFactor: 10, OutlierAction: OutlierFlag},
+			values:    []int64{0, 10, 20, 30, 40, 50, 60, 10060},
+			wantValid: true,
+			wantDelta: 10000,
+			wantFlag:  FlagOutlier,
+		},
+		{
+			name:      "max_delta_factor ignores idle intervals",
+			policy:    Policy{MaxDeltaFactor: 10},
+			values:    []int64{0, 10, 20, 30, 40, 50, 50, 50, 50, 50, 50, 50, 130},
+			wantValid: true,
+			wantDelta: 80,
+		},
+		{
+			name:      "max_delta_factor applies after warmup",
+			policy:    Policy{MaxDeltaFactor: 10},
+			values:    []int64{0, 10, 20, 10020},
+			wantValid: true,
+			wantDelta: 10000,
+		},
+		{
+			name:      "Series starting at a large value",
+			policy:    Policy{MaxDelta: 1000, MaxDeltaFactor: 10, OutlierAction: OutlierFlag},
+			values:    []int64{1000000, 1000010, 1000020, 1000030, 1000040, 1000050, 1000060, 1010060},
+			wantValid: true,
+			wantDelta: 10000,
+			wantFlag:  FlagOutlier,
+		},
+		{
+			name:      "Reset isn't an outlier",
+			policy:    Policy{MaxDelta: 1000},
+			values:    []int64{1000000, 1000010, 1000020, 50000},
+			wantValid: true,
+			wantDelta: 50000,
+		},
+		{
+			name:      "Smaller limit applies",
+			policy:    Policy{MaxDelta: 1e9, MaxDeltaFactor: 10, OutlierAction: OutlierClamp},
+			values:    []int64{0, 10, 20, 30, 40, 50, 60, 10060},
+			wantValid: true,
+			wantDelta: 100,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+			convert := func(i int, value int64) (DeltaValue, bool) {
+				return tr.Convert(MetricPoint{
+					Identity: id,
+					Value:    ValuePoint{ObservedTimestamp: pdata.Timestamp(10 * (i + 1)), IntValue: value},
+					Policy:   tt.policy,
+				})
+			}
+			last := len(tt.values) - 1
+			for i, value := range tt.values[:last] {
+				if out, valid := convert(i, value); !valid || out.Flag != FlagNone {
+					t.Fatalf("MetricTracker.Convert() of point %d = %v, %v, want a plausible delta", i, out, valid)
+				}
+			}
+
+			out, valid := convert(last, tt.values[last])
+			if valid != tt.wantValid {
+				t.Fatalf("MetricTracker.Convert() valid = %v, want %v", valid, tt.wantValid)
+			}
+			if valid && (out.IntValue != tt.wantDelta || out.Flag != tt.wantFlag) {
+				t.Errorf("MetricTracker.Convert() = %v, want a delta of %d flagged %q", out, tt.wantDelta, tt.wantFlag)
+			}
+
+			// The series goes on from the outlier
+			if out, valid := convert(last+1, tt.values[last]+10); !valid || out.IntValue != 10 {
+				t.Errorf("MetricTracker.Convert() after the outlier = %v, %v, want a delta of 10", out, valid)
+			}
+		})
+	}
+}
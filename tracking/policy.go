@@ -0,0 +1,171 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import "time"
+
+// Policy holds the settings a point of a metric is converted with.
+type Policy struct {
+	Wraparound    Wraparound
+	InvalidValues InvalidAction
+	// MaxGap is the longest time between two points of a series whose
+	// delta is converted as usual. Longer gaps are handled according to
+	// GapAction. Zero disables the check.
+	MaxGap    time.Duration
+	GapAction GapAction
+	// MaxDelta is the largest magnitude of a plausible delta. Zero
+	// disables the check.
+	MaxDelta float64
+	// MaxDeltaFactor is how many times larger than the average recent
+	// delta of its series a plausible delta can be. Zero disables the
+	// check.
+	MaxDeltaFactor float64
+	OutlierAction  OutlierAction
+	// Unspecified is how the points of sums with unspecified temporality
+	// are handled.
+	Unspecified UnspecifiedTemporality
+}
+
+// OutlierAction is how an implausible delta is handled.
+type OutlierAction int
+
+const (
+	// OutlierDrop drops the delta.
+	OutlierDrop OutlierAction = iota
+	// OutlierClamp reduces the delta to the largest plausible one.
+	OutlierClamp
+	// OutlierFlag passes the delta on, flagged.
+	OutlierFlag
+)
+
+// GapAction is how the delta across a gap longer than the maximum gap is
+// handled.
+type GapAction int
+
+const (
+	// GapDrop drops the delta, restarting the series from the point.
+	GapDrop GapAction = iota
+	// GapEmit emits the delta, starting at the previous point.
+	GapEmit
+	// GapSpread splits the delta evenly into parts covering at most the
+	// maximum gap each.
+	GapSpread
+)
+
+// maxSpreadParts limits the number of parts a delta is spread into.
+const maxSpreadParts = 1000
+
+// InvalidAction is how a point is handled when its delta can't be
+// computed, because the int64 subtraction overflows or a value is
+// infinite.
+type InvalidAction int
+
+const (
+	// InvalidDrop drops the delta. The previous value is kept when the
+	// point itself is infinite.
+	InvalidDrop InvalidAction = iota
+	// InvalidFlag passes the delta on as computed, flagged.
+	InvalidFlag
+	// InvalidReset starts the series anew from the point, or from the
+	// next one when the point itself is infinite.
+	InvalidReset
+)
+
+// Flag marks a delta which was passed on although it is invalid.
+type Flag int
+
+const (
+	FlagNone Flag = iota
+	// FlagOverflow marks a delta which doesn't fit its type.
+	FlagOverflow
+	// FlagNonFinite marks a delta from or to an infinite value.
+	FlagNonFinite
+	// FlagOutlier marks an implausibly large delta.
+	FlagOutlier
+)
+
+var flagNames = [...]string{
+	FlagNone:      "",
+	FlagOverflow:  "overflow",
+	FlagNonFinite: "non_finite",
+	FlagOutlier:   "outlier",
+}
+
+func (f Flag) String() string {
+	return flagNames[f]
+}
+
+// Wraparound is the width of an unsigned counter, at which it wraps
+// around to zero.
+type Wraparound int
+
+const (
+	// WraparoundNone treats every decrease of a counter as a reset.
+	WraparoundNone Wraparound = iota
+	// Wraparound32 treats counters as unsigned 32 bit integers.
+	Wraparound32
+	// Wraparound64 treats counters as unsigned 64 bit integers, reported
+	// bit for bit as int64 when the value is an integer.
+	Wraparound64
+)
+
+// decreased reports whether the counter went down from prev to value.
+func (w Wraparound) decreased(prev, value int64) bool {
+	if w == Wraparound64 {
+		return uint64(value) < uint64(prev)
+	}
+	return value < prev
+}
+
+// intDelta returns the delta of a counter which decreased from prev to
+// value by wrapping around, and whether a wraparound is plausible. It is
+// only assumed when the delta is below half of the counter range,
+// otherwise the counter was more likely reset.
+func (w Wraparound) intDelta(prev, value int64) (int64, bool) {
+	switch w {
+	case Wraparound32:
+		const limit = 1 << 32
+		if prev >= limit || value < 0 {
+			return 0, false
+		}
+		delta := limit - prev + value
+		return delta, delta <= limit/2
+	case Wraparound64:
+		// Two's complement subtraction wraps the same way the unsigned
+		// counter does.
+		delta := value - prev
+		return delta, delta >= 0
+	default:
+		return 0, false
+	}
+}
+
+// floatDelta is intDelta for counters reported as floating point values.
+func (w Wraparound) floatDelta(prev, value float64) (float64, bool) {
+	var limit float64
+	switch w {
+	case Wraparound32:
+		limit = 1 << 32
+	case Wraparound64:
+		limit = 1 << 64
+	default:
+		return 0, false
+	}
+	if prev >= limit || value < 0 {
+		return 0, false
+	}
+	delta := limit - prev + value
+	return delta, delta <= limit/2
+}
@@ -0,0 +1,107 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+// seriesStart is the start of a series known from elsewhere than the start
+// timestamps of its points, such as an OpenMetrics _created series.
+type seriesStart struct {
+	mu    sync.Mutex
+	start pdata.Timestamp
+	// lastSeen is the time staleness of the series is measured from.
+	lastSeen pdata.Timestamp
+	// removed is set, under mu, once the start is deleted as stale.
+	removed bool
+}
+
+// startKey returns the key of the series of id regardless of its start
+// timestamp.
+func startKey(id MetricIdentity) string {
+	id.StartTimestamp = 0
+	return identityKey(id)
+}
+
+// SetStart remembers start as the start of the series of id, as of its
+// point at timestamp, until the series goes stale.
+func (t *metricTracker) SetStart(id MetricIdentity, start, timestamp pdata.Timestamp) {
+	key := startKey(id)
+	for {
+		v, _ := t.starts.LoadOrStore(key, &seriesStart{})
+		s := v.(*seriesStart)
+		s.mu.Lock()
+		if s.removed {
+			// The start was removed as stale after it was loaded. Retry so
+			// the start replacing it is set instead.
+			s.mu.Unlock()
+			continue
+		}
+		s.start = start
+		t.seen(&s.lastSeen, timestamp)
+		s.mu.Unlock()
+		return
+	}
+}
+
+// Start returns the start remembered for the series of id, as of its point
+// at timestamp.
+func (t *metricTracker) Start(id MetricIdentity, timestamp pdata.Timestamp) (pdata.Timestamp, bool) {
+	key := startKey(id)
+	for {
+		v, ok := t.starts.Load(key)
+		if !ok {
+			return 0, false
+		}
+		s := v.(*seriesStart)
+		s.mu.Lock()
+		if s.removed {
+			// The start was removed as stale after it was loaded. Retry
+			// against a start set since, if any.
+			s.mu.Unlock()
+			continue
+		}
+		t.seen(&s.lastSeen, timestamp)
+		start := s.start
+		s.mu.Unlock()
+		return start, true
+	}
+}
+
+// seen sets lastSeen to the time a point at timestamp was seen at.
+func (t *metricTracker) seen(lastSeen *pdata.Timestamp, timestamp pdata.Timestamp) {
+	*lastSeen = timestamp
+	if t.stalenessClock == ReceiveTime {
+		*lastSeen = t.receiveTime()
+	}
+}
+
+// sweepStarts forgets the starts of series last seen before staleBefore,
+// marking them as removed under their lock like inferences.
+func (t *metricTracker) sweepStarts(staleBefore pdata.Timestamp) {
+	t.starts.Range(func(key, value interface{}) bool {
+		s := value.(*seriesStart)
+		s.mu.Lock()
+		if s.lastSeen < staleBefore {
+			t.starts.Delete(key)
+			s.removed = true
+		}
+		s.mu.Unlock()
+		return true
+	})
+}
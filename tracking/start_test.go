@@ -0,0 +1,91 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestMetricTracker_SeriesStart(t *testing.T) {
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), time.Minute).(*metricTracker)
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 5
+	tr.SetStart(id, 10, pdata.Timestamp(time.Second))
+
+	// The start is remembered whatever the start timestamp of the point
+	id.StartTimestamp = 0
+	if start, ok := tr.Start(id, pdata.Timestamp(2*time.Second)); !ok || start != 10 {
+		t.Errorf("MetricTracker.Start() = %v, %v, want 10", start, ok)
+	}
+
+	tr.sweep(time.Unix(0, 0).Add(time.Minute + 3*time.Second))
+	if start, ok := tr.Start(id, pdata.Timestamp(2*time.Minute)); ok {
+		t.Errorf("MetricTracker.Start() of a stale series = %v, want none", start)
+	}
+}
+
+// TestMetricTracker_ConcurrentStartRemoval sets and reads starts while stale
+// starts are removed concurrently. Run it with -race. Each series alternates
+// between stale points and fresh ones, whose start must never be lost.
+func TestMetricTracker_ConcurrentStartRemoval(t *testing.T) {
+	const (
+		series  = 8
+		points  = 20000
+		staleAt = pdata.Timestamp(1 << 40)
+	)
+	tr := &metricTracker{logger: zap.NewNop()}
+
+	done := make(chan struct{})
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				tr.sweepStarts(staleAt)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < series; i++ {
+		id := newSumIdentity(true, pdata.MetricValueTypeInt)
+		id.MetricName = strconv.Itoa(i)
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := pdata.Timestamp(1); j <= points; j++ {
+				tr.SetStart(id, j, j+1)
+				tr.SetStart(id, j, staleAt+j)
+				if start, ok := tr.Start(id, staleAt+j); !ok || start != j {
+					t.Errorf("MetricTracker.Start() of series %v = %v, %v, want %v", id.MetricName, start, ok, j)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-swept
+}
@@ -0,0 +1,138 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"sync"
+
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+// UnspecifiedTemporality is how the points of sums with unspecified
+// aggregation temporality are handled.
+type UnspecifiedTemporality int
+
+const (
+	// UnspecifiedIgnore leaves them unconverted.
+	UnspecifiedIgnore UnspecifiedTemporality = iota
+	// UnspecifiedCumulative converts them as cumulative.
+	UnspecifiedCumulative
+	// UnspecifiedInfer converts the series inferred to be cumulative from
+	// their values as cumulative.
+	UnspecifiedInfer
+)
+
+// temporalityInferencePoints is the number of consecutive points of a
+// series with unspecified temporality which must look cumulative for the
+// series to be converted as cumulative.
+const temporalityInferencePoints = 3
+
+// temporalityInference infers whether a series with unspecified
+// temporality is cumulative. As the start timestamp of a series which
+// turns out to be a delta changes with every point, the inference is kept
+// for the series regardless of its start timestamp.
+type temporalityInference struct {
+	mu     sync.Mutex
+	prev   MetricPoint
+	points int
+	// inferred is set once the series is known to be cumulative or not.
+	inferred   bool
+	cumulative bool
+	// lastSeen is the time staleness of the series is measured from.
+	lastSeen pdata.Timestamp
+	// removed is set, under mu, once the inference is deleted as stale.
+	removed bool
+}
+
+// Cumulative reports whether in, a point of a sum with unspecified
+// temporality, is converted as cumulative. A series is cumulative once its
+// start timestamp stayed the same and its value didn't decrease over a few
+// points. It is not cumulative as soon as a point starts where the
+// previous one ended, as deltas do. A series which restarts, with a new
+// start timestamp or with a decreasing value, is inferred anew, unless it
+// was already found to be cumulative.
+func (t *metricTracker) Cumulative(in MetricPoint) bool {
+	id := in.Identity
+	id.StartTimestamp = 0
+	key := identityKey(id)
+	var inference *temporalityInference
+	for {
+		v, ok := t.temporalities.Load(key)
+		if !ok {
+			v, _ = t.temporalities.LoadOrStore(key, &temporalityInference{})
+		}
+		inference = v.(*temporalityInference)
+		inference.mu.Lock()
+		if !inference.removed {
+			break
+		}
+		// The inference was removed as stale after it was loaded. Retry so
+		// the point updates the inference replacing it.
+		inference.mu.Unlock()
+	}
+	defer inference.mu.Unlock()
+	t.seen(&inference.lastSeen, in.Value.ObservedTimestamp)
+	if inference.inferred {
+		return inference.cumulative
+	}
+
+	prev := inference.prev
+	if inference.points > 0 && in.Value.ObservedTimestamp <= prev.Value.ObservedTimestamp {
+		// Out of order and repeated points tell nothing new
+		return false
+	}
+	switch {
+	case inference.points == 0 || in.Identity.StartTimestamp != prev.Identity.StartTimestamp &&
+		(in.Identity.StartTimestamp == 0 || in.Identity.StartTimestamp != prev.Value.ObservedTimestamp):
+		// The first point, or the series restarted
+		inference.points = 1
+	case in.Identity.StartTimestamp != prev.Identity.StartTimestamp:
+		// The point starts where the previous one ended
+		inference.inferred = true
+	case in.Identity.IsFloatVal() && in.Value.FloatValue < prev.Value.FloatValue,
+		!in.Identity.IsFloatVal() && in.Value.IntValue < prev.Value.IntValue:
+		// A decrease is taken for a restart keeping the start timestamp
+		inference.points = 1
+	default:
+		inference.points++
+	}
+	inference.prev = MetricPoint{Identity: in.Identity.Clone(), Value: in.Value}
+	if inference.points < temporalityInferencePoints || inference.inferred {
+		return false
+	}
+
+	inference.inferred = true
+	inference.cumulative = true
+	// The delta of the point is computed against the previous one
+	t.Restore(MetricPoint{Identity: prev.Identity, Value: prev.Value})
+	t.logEvent(EventUnspecified, in.Identity, in.Value, &prev.Value)
+	return true
+}
+
+// sweepTemporalities removes the inferences of series last seen before
+// staleBefore. As with states, they are removed under their lock and marked
+// as removed, so that an inference racing with the removal is not lost.
+func (t *metricTracker) sweepTemporalities(staleBefore pdata.Timestamp) {
+	t.temporalities.Range(func(key, value interface{}) bool {
+		inference := value.(*temporalityInference)
+		inference.mu.Lock()
+		if inference.lastSeen < staleBefore {
+			t.temporalities.Delete(key)
+			inference.removed = true
+		}
+		inference.mu.Unlock()
+		return true
+	})
+}
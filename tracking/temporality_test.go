@@ -0,0 +1,186 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"reflect"
+	"strconv"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestMetricTracker_Cumulative(t *testing.T) {
+	type point struct {
+		start pdata.Timestamp
+		value int64
+	}
+	tests := []struct {
+		name           string
+		points         []point
+		wantCumulative []bool
+		wantDeltas     []int64
+		wantEvents     []Event
+	}{
+		{
+			name:           "Cumulative series",
+			points:         []point{{1, 10}, {1, 20}, {1, 30}, {1, 45}},
+			wantCumulative: []bool{false, false, true, true},
+			wantDeltas:     []int64{10, 15},
+			wantEvents:     []Event{EventUnspecified},
+		},
+		{
+			name:           "Delta series",
+			points:         []point{{0, 10}, {10, 20}, {20, 30}, {30, 40}},
+			wantCumulative: []bool{false, false, false, false},
+		},
+		{
+			name:           "Decrease restarts the inference",
+			points:         []point{{1, 10}, {1, 20}, {1, 5}, {1, 40}, {1, 50}},
+			wantCumulative: []bool{false, false, false, false, true},
+			wantDeltas:     []int64{10},
+			wantEvents:     []Event{EventUnspecified},
+		},
+		{
+			name:           "Often decreasing series",
+			points:         []point{{1, 10}, {1, 20}, {1, 5}, {1, 8}, {1, 3}, {1, 4}},
+			wantCumulative: []bool{false, false, false, false, false, false},
+		},
+		{
+			name:           "Restarted series",
+			points:         []point{{1, 10}, {1, 20}, {25, 5}, {25, 6}, {25, 8}},
+			wantCumulative: []bool{false, false, false, false, true},
+			wantDeltas:     []int64{2},
+			wantEvents:     []Event{EventUnspecified},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var events []Event
+			tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithEventFunc(func(event Event) {
+				events = append(events, event)
+			}))
+			var deltas []int64
+			for i, p := range tt.points {
+				id := newSumIdentity(true, pdata.MetricValueTypeInt)
+				id.StartTimestamp = p.start
+				in := MetricPoint{
+					Identity: id,
+					Value:    ValuePoint{ObservedTimestamp: pdata.Timestamp(10 * (i + 1)), IntValue: p.value},
+				}
+				if got := tr.Cumulative(in); got != tt.wantCumulative[i] {
+					t.Errorf("MetricTracker.Cumulative() of point %d = %v, want %v", i, got, tt.wantCumulative[i])
+				}
+				if tt.wantCumulative[i] {
+					in.UnspecifiedTemporality = true
+					out, valid := tr.Convert(in)
+					if !valid {
+						t.Fatalf("MetricTracker.Convert() of point %d is invalid", i)
+					}
+					deltas = append(deltas, out.IntValue)
+				}
+			}
+			if !reflect.DeepEqual(deltas, tt.wantDeltas) {
+				t.Errorf("MetricTracker.Convert() deltas = %v, want %v", deltas, tt.wantDeltas)
+			}
+			if !reflect.DeepEqual(events, tt.wantEvents) {
+				t.Errorf("reported events %v, want %v", events, tt.wantEvents)
+			}
+		})
+	}
+}
+
+func TestMetricTracker_UnspecifiedReported(t *testing.T) {
+	var events []Event
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithEventFunc(func(event Event) {
+		events = append(events, event)
+	}))
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 1
+	for i, value := range []int64{10, 20, 30} {
+		tr.Convert(MetricPoint{
+			Identity:               id,
+			Value:                  ValuePoint{ObservedTimestamp: pdata.Timestamp(10 * (i + 1)), IntValue: value},
+			UnspecifiedTemporality: true,
+		})
+	}
+	// Reported once, when the series starts being converted
+	if want := []Event{EventUnspecified}; !reflect.DeepEqual(events, want) {
+		t.Errorf("reported events %v, want %v", events, want)
+	}
+}
+
+// TestMetricTracker_ConcurrentTemporalityRemoval infers temporalities while
+// stale inferences are removed concurrently. Run it with -race. Each series
+// alternates between stale points and fresh ones, which must never go to an
+// inference already removed.
+func TestMetricTracker_ConcurrentTemporalityRemoval(t *testing.T) {
+	const (
+		series  = 8
+		points  = 20000
+		staleAt = pdata.Timestamp(1 << 40)
+	)
+	tr := &metricTracker{logger: zap.NewNop()}
+
+	done := make(chan struct{})
+	swept := make(chan struct{})
+	go func() {
+		defer close(swept)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+				tr.sweepTemporalities(staleAt)
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for i := 0; i < series; i++ {
+		id := newSumIdentity(true, pdata.MetricValueTypeInt)
+		id.MetricName = strconv.Itoa(i)
+		id.StartTimestamp = 1
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := pdata.Timestamp(1); j <= points; j++ {
+				tr.Cumulative(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: j + 1, IntValue: 1}})
+				tr.Cumulative(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: staleAt + j, IntValue: 1}})
+				key := id
+				key.StartTimestamp = 0
+				v, ok := tr.temporalities.Load(identityKey(key))
+				if !ok {
+					t.Errorf("series %v lost its inference", id.MetricName)
+					return
+				}
+				inference := v.(*temporalityInference)
+				inference.mu.Lock()
+				lastSeen := inference.lastSeen
+				inference.mu.Unlock()
+				if lastSeen != staleAt+j {
+					t.Errorf("series %v lost an update: last seen = %v, want %v", id.MetricName, lastSeen, staleAt+j)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	<-swept
+}
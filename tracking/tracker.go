@@ -23,6 +23,7 @@ import (
 
 	"go.opentelemetry.io/collector/model/pdata"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 )
 
 // Allocate a minimum of 64 bytes to the builder initially
@@ -35,9 +36,30 @@ var identityBufferPool = sync.Pool{
 }
 
 type State struct {
-	Identity  MetricIdentity
-	PrevPoint ValuePoint
-	mu        sync.Mutex
+	Identity      MetricIdentity
+	PrevPoint     ValuePoint
+	LastHeartbeat pdata.Timestamp
+	// LastReceived is the local time the last point was received at. It
+	// is only recorded when staleness is based on the receive time.
+	LastReceived pdata.Timestamp
+	// Accumulated holds the deltas awaiting the next flush when
+	// aggregating. It is nil when nothing is pending.
+	Accumulated *DeltaPoint
+	// restart is set when the next point starts the series anew, as its
+	// first observation.
+	restart bool
+	// deltas averages the magnitude of the recent deltas of the series.
+	deltas    deltaAverage
+	inference monotonicityInference
+	// window is the running total of the current window when deltas are
+	// added up over windows.
+	window window
+	// bucket is the part of the deltas not completing a bucket yet when
+	// deltas are aligned to buckets.
+	bucket bucket
+	mu     sync.Mutex
+	// removed is set, under mu, once the state is deleted from the tracker.
+	removed bool
 }
 
 func (s *State) Lock() {
@@ -48,28 +70,240 @@ func (s *State) Unlock() {
 	s.mu.Unlock()
 }
 
+// heartbeat returns a zero valued delta covering the time since the
+// series last produced a delta.
+func (s *State) heartbeat(now pdata.Timestamp) DeltaPoint {
+	out := DeltaPoint{
+		Identity:  s.Identity,
+		Timestamp: now,
+	}
+	out.Value.StartTimestamp = s.PrevPoint.ObservedTimestamp
+	if s.LastHeartbeat > out.Value.StartTimestamp {
+		out.Value.StartTimestamp = s.LastHeartbeat
+	}
+	s.LastHeartbeat = now
+	return out
+}
+
+// accumulate adds delta to the deltas awaiting the next flush.
+func (s *State) accumulate(delta DeltaValue, timestamp pdata.Timestamp) {
+	if s.Accumulated == nil {
+		s.Accumulated = &DeltaPoint{
+			Identity:  s.Identity,
+			Value:     delta,
+			Timestamp: timestamp,
+		}
+		return
+	}
+	s.Accumulated.Value.FloatValue += delta.FloatValue
+	s.Accumulated.Value.IntValue += delta.IntValue
+	if s.Accumulated.Value.Flag == FlagNone {
+		s.Accumulated.Value.Flag = delta.Flag
+	}
+	s.Accumulated.Timestamp = timestamp
+}
+
+// takeAccumulated returns the pending accumulated delta, if any, and
+// clears it.
+func (s *State) takeAccumulated() (DeltaPoint, bool) {
+	if s.Accumulated == nil {
+		return DeltaPoint{}, false
+	}
+	out := *s.Accumulated
+	s.Accumulated = nil
+	return out, true
+}
+
 type DeltaValue struct {
 	StartTimestamp pdata.Timestamp
 	FloatValue     float64
 	IntValue       int64
+	// Flag marks a delta passed on although it is invalid.
+	Flag Flag
+	// EndTimestamp is the end of the delta when it differs from the
+	// timestamp of the point it was converted from, and 0 otherwise.
+	EndTimestamp pdata.Timestamp
+	// Deferred is set on the invalid delta of a point which is sent later
+	// instead, accumulated until the next flush or carried over to the
+	// next aligned bucket.
+	Deferred bool
+}
+
+// DeltaPoint is a delta produced by the tracker outside of Convert.
+type DeltaPoint struct {
+	Identity  MetricIdentity
+	Value     DeltaValue
+	Timestamp pdata.Timestamp
+}
+
+// DeltaFunc receives deltas produced by the tracker in the background.
+type DeltaFunc func([]DeltaPoint)
+
+// SeriesState is a copy of the state tracked for a series.
+type SeriesState struct {
+	Key       string
+	Identity  MetricIdentity
+	PrevPoint ValuePoint
+	// LastSeen is the time staleness of the series is measured from.
+	LastSeen pdata.Timestamp
+	// Inferred is the monotonicity inferred for the series.
+	Inferred Monotonicity
 }
 
+// StalenessClock selects the clock staleness and heartbeats are measured
+// with.
+type StalenessClock int
+
+const (
+	// PointTime measures staleness from the timestamp of the last point,
+	// as reported by the source.
+	PointTime StalenessClock = iota
+	// ReceiveTime measures staleness from the local time the last point
+	// was received at.
+	ReceiveTime
+)
+
 type MetricTracker interface {
 	Convert(MetricPoint) (DeltaValue, bool)
+	// Flush emits all accumulated deltas when aggregating.
+	Flush()
+	// States returns a copy of the state of all tracked series.
+	States() []SeriesState
+	// Remove deletes the state of the series with the given key.
+	Remove(key string) bool
+	// Restore sets the state of a series from its last converted point.
+	Restore(MetricPoint)
+	// Monotonic reports whether the series of id is converted as
+	// monotonic: as inferred when monotonicity is inferred and known, and
+	// as declared otherwise.
+	Monotonic(MetricIdentity) bool
+	// Cumulative reports whether a point of a sum with unspecified
+	// temporality is converted as cumulative, as inferred from the values
+	// of its series.
+	Cumulative(MetricPoint) bool
+	// SetStart remembers start as the start of the series of id, whatever
+	// the start timestamps of its points, as of its point at timestamp.
+	SetStart(id MetricIdentity, start, timestamp pdata.Timestamp)
+	// Start returns the start remembered for the series of id, as of its
+	// point at timestamp.
+	Start(id MetricIdentity, timestamp pdata.Timestamp) (pdata.Timestamp, bool)
+}
+
+// Option configures optional behavior of the tracker.
+type Option func(*metricTracker)
+
+// WithHeartbeat emits a zero valued delta through fn for every series
+// which was not seen during the last interval. Heartbeats continue until
+// the series is removed as stale.
+func WithHeartbeat(interval time.Duration, fn DeltaFunc) Option {
+	return func(t *metricTracker) {
+		t.heartbeatInterval = interval
+		t.heartbeatFunc = fn
+	}
+}
+
+// WithAggregation accumulates deltas per series instead of returning them
+// from Convert. The accumulated deltas are emitted through fn every
+// interval, and on Flush.
+func WithAggregation(interval time.Duration, fn DeltaFunc) Option {
+	return func(t *metricTracker) {
+		t.flushInterval = interval
+		t.flushFunc = fn
+	}
+}
+
+// WithSweepInterval sets how often stale state is removed and heartbeats
+// are emitted. It defaults to the heartbeat interval when heartbeats are
+// enabled, and to maxStale otherwise.
+func WithSweepInterval(interval time.Duration) Option {
+	return func(t *metricTracker) {
+		t.sweepInterval = interval
+	}
+}
+
+// WithStalenessClock selects the clock staleness and heartbeats are
+// measured with. It defaults to PointTime.
+func WithStalenessClock(clock StalenessClock) Option {
+	return func(t *metricTracker) {
+		t.stalenessClock = clock
+	}
+}
+
+// WithGapSpread emits the parts of a delta spread over a gap through fn,
+// except the last one which is returned by Convert. Without it, deltas are
+// not spread.
+func WithGapSpread(fn DeltaFunc) Option {
+	return func(t *metricTracker) {
+		t.gapFunc = fn
+	}
+}
+
+// MissingStart is how the first point of a monotonic series is converted
+// when it has no start timestamp before its own timestamp.
+type MissingStart int
+
+const (
+	// MissingStartTrackerStart starts the delta when the tracker was
+	// created, dropping it when the point is older.
+	MissingStartTrackerStart MissingStart = iota
+	// MissingStartDrop drops the delta.
+	MissingStartDrop
+)
+
+// WithMissingStart selects how the first point of a monotonic series is
+// converted when it has no start timestamp before its own timestamp. It
+// defaults to MissingStartTrackerStart.
+func WithMissingStart(missingStart MissingStart) Option {
+	return func(t *metricTracker) {
+		t.missingStart = missingStart
+	}
 }
 
-func NewMetricTracker(ctx context.Context, logger *zap.Logger, maxStale time.Duration) MetricTracker {
-	t := &metricTracker{logger: logger, maxStale: maxStale}
-	if maxStale > 0 {
-		go t.sweeper(ctx, t.removeStale)
+func NewMetricTracker(ctx context.Context, logger *zap.Logger, maxStale time.Duration, opts ...Option) MetricTracker {
+	t := &metricTracker{logger: logger, maxStale: maxStale, clock: realClock{}}
+	for _, opt := range opts {
+		opt(t)
+	}
+	t.startTime = pdata.TimestampFromTime(t.clock.Now())
+	if t.sweepInterval <= 0 {
+		t.sweepInterval = maxStale
+		if t.heartbeatInterval > 0 {
+			t.sweepInterval = t.heartbeatInterval
+		}
+	}
+	if maxStale > 0 || t.heartbeatInterval > 0 {
+		go t.sweeper(ctx, t.sweep)
+	}
+	if t.flushInterval > 0 {
+		go t.flusher(ctx, t.Flush)
 	}
 	return t
 }
 
 type metricTracker struct {
-	logger   *zap.Logger
-	maxStale time.Duration
-	states   sync.Map
+	logger            *zap.Logger
+	clock             Clock
+	startTime         pdata.Timestamp
+	missingStart      MissingStart
+	inferencePoints   int
+	maxStale          time.Duration
+	sweepInterval     time.Duration
+	stalenessClock    StalenessClock
+	heartbeatInterval time.Duration
+	heartbeatFunc     DeltaFunc
+	flushInterval     time.Duration
+	flushFunc         DeltaFunc
+	gapFunc           DeltaFunc
+	windows           Windows
+	windowFunc        DeltaFunc
+	alignment         time.Duration
+	alignFunc         DeltaFunc
+	eventFunc         EventFunc
+	events            *zap.Logger
+	eventLevel        zapcore.Level
+	states            sync.Map
+	temporalities     sync.Map
+	starts            sync.Map
 }
 
 func (t *metricTracker) Convert(in MetricPoint) (out DeltaValue, valid bool) {
@@ -83,106 +317,494 @@ func (t *metricTracker) Convert(in MetricPoint) (out DeltaValue, valid bool) {
 	// These are ignored for now.
 	// https://github.com/open-telemetry/opentelemetry-collector/pull/3423
 	if metricID.IsFloatVal() && math.IsNaN(metricPoint.FloatValue) {
+		t.logEvent(EventNaNSkipped, metricID, metricPoint, nil)
+		return
+	}
+
+	hashableID := identityKey(metricID)
+
+	for {
+		var s interface{}
+		var ok bool
+		if s, ok = t.states.Load(hashableID); !ok {
+			s, ok = t.states.LoadOrStore(hashableID, &State{
+				Identity:     metricID.Clone(),
+				PrevPoint:    metricPoint,
+				LastReceived: t.receiveTime(),
+			})
+		}
+
+		state := s.(*State)
+		state.Lock()
+		if state.removed {
+			// The state was removed as stale after it was loaded. Retry so
+			// the point updates the state replacing it instead of being lost.
+			state.Unlock()
+			continue
+		}
+		var spread bool
+		var aligned, closed []DeltaPoint
+		out, valid, spread = t.update(state, !ok, metricID, metricPoint, in.Policy)
+		if !ok && in.UnspecifiedTemporality {
+			t.logEvent(EventUnspecified, metricID, metricPoint, nil)
+		}
+		if valid && t.windows != nil {
+			out, closed = state.window.add(t.windows, state.Identity, out, metricPoint.ObservedTimestamp)
+		}
+		if valid && t.alignment > 0 {
+			out, valid, aligned = t.align(state, out, metricPoint.ObservedTimestamp)
+			spread = false
+		}
+		if ok {
+			state.LastReceived = t.receiveTime()
+		}
+		state.Unlock()
+		if spread {
+			out = t.spread(state.Identity, out, metricPoint.ObservedTimestamp, in.Policy.MaxGap)
+		}
+		if len(aligned) > 0 {
+			t.alignFunc(aligned)
+		}
+		if len(closed) > 0 && t.windowFunc != nil {
+			t.windowFunc(closed)
+		}
+		return
+	}
+}
+
+// Restore sets the state of the series of in as if in was the last point
+// converted, without producing a delta.
+func (t *metricTracker) Restore(in MetricPoint) {
+	if !in.Identity.IsSupportedMetricType() {
+		return
+	}
+	hashableID := identityKey(in.Identity)
+
+	for {
+		s, ok := t.states.LoadOrStore(hashableID, &State{
+			Identity:     in.Identity.Clone(),
+			PrevPoint:    in.Value,
+			LastReceived: t.receiveTime(),
+		})
+		if !ok {
+			return
+		}
+
+		state := s.(*State)
+		state.Lock()
+		if state.removed {
+			state.Unlock()
+			continue
+		}
+		state.PrevPoint = in.Value
+		state.LastReceived = t.receiveTime()
+		state.Unlock()
 		return
 	}
+}
 
+// identityKey returns the key the state of the series identified by id is
+// stored under.
+func identityKey(id MetricIdentity) string {
 	b := identityBufferPool.Get().(*bytes.Buffer)
 	b.Reset()
-	metricID.Write(b)
-	hashableID := b.String()
+	id.Write(b)
+	key := b.String()
 	identityBufferPool.Put(b)
+	return key
+}
 
-	var s interface{}
-	var ok bool
-	if s, ok = t.states.Load(hashableID); !ok {
-		s, ok = t.states.LoadOrStore(hashableID, &State{
-			Identity:  metricID,
-			PrevPoint: metricPoint,
-		})
-	}
+// update computes the delta of metricPoint against the locked state of its
+// series. first is true when the state was created from metricPoint. spread
+// is true when the delta is to be spread over the gap it covers.
+func (t *metricTracker) update(state *State, first bool, metricID MetricIdentity, metricPoint ValuePoint, policy Policy) (out DeltaValue, valid, spread bool) {
+	// A delta from the start of a series or from a reset or wraparound
+	// isn't the usual change of the series and isn't checked for outliers
+	discontinuous := first || state.restart
+	if discontinuous {
+		prev := state.PrevPoint
+		if !first && prev.ObservedTimestamp >= metricPoint.ObservedTimestamp {
+			t.logEvent(EventOutOfOrder, metricID, metricPoint, &prev)
+			return DeltaValue{}, false, false
+		}
+		state.restart = false
+		state.PrevPoint = metricPoint
+		if metricID.IsFloatVal() && math.IsInf(metricPoint.FloatValue, 0) {
+			t.logEvent(EventNonFinite, metricID, metricPoint, nil)
+			if policy.InvalidValues != InvalidFlag {
+				state.restart = true
+				return
+			}
+			out.Flag = FlagNonFinite
+		}
+		t.infer(state, metricID, metricPoint, false)
+		if !state.isMonotonic() {
+			t.logEvent(EventFirstDropped, metricID, metricPoint, nil)
+			return
+		}
+		if first {
+			out.StartTimestamp = metricID.StartTimestamp
+			if out.StartTimestamp == 0 || out.StartTimestamp >= metricPoint.ObservedTimestamp {
+				// The interval the value accumulated over is unknown
+				out.StartTimestamp = t.startTime
+				if t.missingStart == MissingStartDrop || out.StartTimestamp >= metricPoint.ObservedTimestamp {
+					t.logEvent(EventFirstDropped, metricID, metricPoint, nil)
+					return DeltaValue{}, false, false
+				}
+			}
+		} else {
+			// A series starting anew continues from its previous point, as
+			// the deltas up to it were already emitted
+			out.StartTimestamp = prev.ObservedTimestamp
+		}
+		out.FloatValue = metricPoint.FloatValue
+		out.IntValue = metricPoint.IntValue
+	} else {
+		out.StartTimestamp = state.PrevPoint.ObservedTimestamp
 
-	if !ok {
-		if metricID.MetricIsMonotonic {
-			out = DeltaValue{
-				StartTimestamp: metricPoint.ObservedTimestamp,
-				FloatValue:     metricPoint.FloatValue,
-				IntValue:       metricPoint.IntValue,
+		// Heartbeats already covered the interval up to the last heartbeat
+		if state.LastHeartbeat > out.StartTimestamp && state.LastHeartbeat < metricPoint.ObservedTimestamp {
+			out.StartTimestamp = state.LastHeartbeat
+		}
+
+		// A delta must start before it ends, so a point not after the
+		// previous one is dropped, keeping the previous point as the
+		// reference.
+		if out.StartTimestamp >= metricPoint.ObservedTimestamp {
+			t.logEvent(EventOutOfOrder, metricID, metricPoint, &state.PrevPoint)
+			return DeltaValue{}, false, false
+		}
+
+		if metricID.IsFloatVal() {
+			t.infer(state, metricID, metricPoint, metricPoint.FloatValue < state.PrevPoint.FloatValue)
+		} else {
+			t.infer(state, metricID, metricPoint, policy.Wraparound.decreased(state.PrevPoint.IntValue, metricPoint.IntValue))
+		}
+		monotonic := state.isMonotonic()
+
+		var flag Flag
+		if metricID.IsFloatVal() {
+			value := metricPoint.FloatValue
+			prevValue := state.PrevPoint.FloatValue
+			delta := value - prevValue
+
+			// Detect wraparound or reset on a monotonic counter
+			if monotonic && value < prevValue {
+				if wrapped, ok := policy.Wraparound.floatDelta(prevValue, value); ok {
+					delta = wrapped
+					t.logEvent(EventCounterWraparound, metricID, metricPoint, &state.PrevPoint)
+					discontinuous = true
+				} else {
+					delta = value
+					t.logEvent(EventCounterReset, metricID, metricPoint, &state.PrevPoint)
+					discontinuous = true
+				}
+			}
+
+			switch {
+			case math.IsInf(value, 0) || math.IsInf(prevValue, 0):
+				flag = FlagNonFinite
+			case math.IsInf(delta, 0):
+				flag = FlagOverflow
+			}
+			out.FloatValue = delta
+		} else {
+			value := metricPoint.IntValue
+			prevValue := state.PrevPoint.IntValue
+			delta := value - prevValue
+
+			// Detect wraparound or reset on a monotonic counter
+			if monotonic && policy.Wraparound.decreased(prevValue, value) {
+				if wrapped, ok := policy.Wraparound.intDelta(prevValue, value); ok {
+					delta = wrapped
+					t.logEvent(EventCounterWraparound, metricID, metricPoint, &state.PrevPoint)
+					discontinuous = true
+				} else {
+					delta = value
+					t.logEvent(EventCounterReset, metricID, metricPoint, &state.PrevPoint)
+					discontinuous = true
+				}
+			} else if policy.Wraparound != Wraparound64 && (value^prevValue)&(value^delta) < 0 {
+				// The signs of the operands differ and the sign of the
+				// result differs from the minuend's
+				flag = FlagOverflow
 			}
-			valid = true
+			out.IntValue = delta
 		}
-		return
+
+		if flag != FlagNone {
+			if flag == FlagOverflow {
+				t.logEvent(EventOverflow, metricID, metricPoint, &state.PrevPoint)
+			} else {
+				t.logEvent(EventNonFinite, metricID, metricPoint, &state.PrevPoint)
+			}
+			switch policy.InvalidValues {
+			case InvalidDrop:
+				if !metricID.IsFloatVal() || !math.IsInf(metricPoint.FloatValue, 0) {
+					state.PrevPoint = metricPoint
+				}
+				return DeltaValue{}, false, false
+			case InvalidReset:
+				state.restart = true
+				return t.update(state, false, metricID, metricPoint, policy)
+			}
+			out.Flag = flag
+		}
+
+		if policy.MaxGap > 0 && time.Duration(metricPoint.ObservedTimestamp-state.PrevPoint.ObservedTimestamp) > policy.MaxGap {
+			t.logEvent(EventGap, metricID, metricPoint, &state.PrevPoint)
+			switch policy.GapAction {
+			case GapDrop:
+				state.PrevPoint = metricPoint
+				return DeltaValue{}, false, false
+			case GapSpread:
+				spread = t.gapFunc != nil
+			}
+		}
+
+		state.PrevPoint = metricPoint
 	}
-	valid = true
 
-	state := s.(*State)
-	state.Lock()
-	defer state.Unlock()
+	if !discontinuous && !t.checkOutlier(state, &out, metricID, metricPoint, policy) {
+		return DeltaValue{}, false, false
+	}
+
+	// Deltas added up over windows are neither accumulated nor spread
+	if t.windows != nil {
+		return out, true, false
+	}
 
-	out.StartTimestamp = state.PrevPoint.ObservedTimestamp
+	if t.flushInterval > 0 {
+		state.accumulate(out, metricPoint.ObservedTimestamp)
+		return DeltaValue{Deferred: true}, false, false
+	}
+	return out, true, spread
+}
 
-	if metricID.IsFloatVal() {
-		value := metricPoint.FloatValue
-		prevValue := state.PrevPoint.FloatValue
-		delta := value - prevValue
+// spread splits delta, ending at timestamp, into even parts covering at
+// most maxGap each, or into maxSpreadParts parts when it takes more. The
+// remainder of an integer delta is split across the first parts, one each.
+// All parts but the last are emitted through gapFunc, the last one is
+// returned.
+func (t *metricTracker) spread(id MetricIdentity, delta DeltaValue, timestamp pdata.Timestamp, maxGap time.Duration) DeltaValue {
+	width := uint64(timestamp - delta.StartTimestamp)
+	n := (width + uint64(maxGap) - 1) / uint64(maxGap)
+	if n > maxSpreadParts {
+		n = maxSpreadParts
+	}
+	if n < 2 {
+		return delta
+	}
+	step := pdata.Timestamp(width / n)
+	intPart := delta.IntValue / int64(n)
+	remainder := delta.IntValue % int64(n)
+	floatPart := delta.FloatValue / float64(n)
 
-		// Detect reset on a monotonic counter
-		if metricID.MetricIsMonotonic && value < prevValue {
-			delta = value
+	parts := make([]DeltaPoint, 0, n-1)
+	start := delta.StartTimestamp
+	var intSplit int64
+	for i := uint64(1); i < n; i++ {
+		part := DeltaValue{StartTimestamp: start, IntValue: intPart, FloatValue: floatPart, Flag: delta.Flag}
+		switch {
+		case remainder > 0:
+			part.IntValue++
+			remainder--
+		case remainder < 0:
+			part.IntValue--
+			remainder++
 		}
+		intSplit += part.IntValue
+		parts = append(parts, DeltaPoint{
+			Identity:  id,
+			Value:     part,
+			Timestamp: start + step,
+		})
+		start += step
+	}
+	t.gapFunc(parts)
 
-		out.FloatValue = delta
-	} else {
-		value := metricPoint.IntValue
-		prevValue := state.PrevPoint.IntValue
-		delta := value - prevValue
+	// The last part takes the rest
+	last := delta
+	last.StartTimestamp = start
+	last.IntValue -= intSplit
+	last.FloatValue -= floatPart * float64(n-1)
+	return last
+}
 
-		// Detect reset on a monotonic counter
-		if metricID.MetricIsMonotonic && value < prevValue {
-			delta = value
-		}
+// receiveTime returns the local time a point is received at, when
+// staleness is measured with it.
+func (t *metricTracker) receiveTime() pdata.Timestamp {
+	if t.stalenessClock != ReceiveTime {
+		return 0
+	}
+	return pdata.TimestampFromTime(t.clock.Now())
+}
 
-		out.IntValue = delta
+// sourceTime returns the local time local in the clock of the source of
+// the locked state, which the timestamps of its deltas are in. When
+// staleness is measured with the receive time, the source clock isn't
+// assumed to match the local one: local is shifted by the time elapsed
+// since the last point of the series was received.
+func (t *metricTracker) sourceTime(s *State, local pdata.Timestamp) pdata.Timestamp {
+	if t.stalenessClock != ReceiveTime {
+		return local
 	}
+	if local < s.LastReceived {
+		return s.PrevPoint.ObservedTimestamp
+	}
+	return s.PrevPoint.ObservedTimestamp + (local - s.LastReceived)
+}
 
-	state.PrevPoint = metricPoint
-	return
+// lastSeen returns the time staleness of the locked state is measured from.
+func (t *metricTracker) lastSeen(s *State) pdata.Timestamp {
+	if t.stalenessClock == ReceiveTime {
+		return s.LastReceived
+	}
+	return s.PrevPoint.ObservedTimestamp
 }
 
-func (t *metricTracker) removeStale(staleBefore pdata.Timestamp) {
+func (t *metricTracker) States() []SeriesState {
+	var out []SeriesState
 	t.states.Range(func(key, value interface{}) bool {
 		s := value.(*State)
+		s.Lock()
+		out = append(out, SeriesState{
+			Key:       key.(string),
+			Identity:  s.Identity,
+			PrevPoint: s.PrevPoint,
+			LastSeen:  t.lastSeen(s),
+			Inferred:  s.inference.inferred,
+		})
+		s.Unlock()
+		return true
+	})
+	return out
+}
+
+func (t *metricTracker) Remove(key string) bool {
+	s, ok := t.states.Load(key)
+	if !ok {
+		return false
+	}
+	state := s.(*State)
+	state.Lock()
+	defer state.Unlock()
+	if state.removed {
+		return false
+	}
+	state.removed = true
+	t.states.Delete(key)
+	return true
+}
 
-		// There is a known race condition here.
-		// Because the state may be in the process of updating at the
-		// same time as the stale removal, there is a chance that we
-		// will remove a "stale" state that is in the process of
-		// updating. This can only happen when datapoints arrive around
-		// the expiration time.
-		//
-		// In this case, the possible outcomes are:
-		//	* Updating goroutine wins, point will not be stale
-		//	* Stale removal wins, updating goroutine will still see
-		//	  the removed state but the state after the update will
-		//	  not be persisted. The next update will load an entirely
-		//	  new state.
+func (t *metricTracker) Flush() {
+	var flushed, aligned []DeltaPoint
+	t.states.Range(func(_, value interface{}) bool {
+		s := value.(*State)
 		s.Lock()
-		lastObserved := s.PrevPoint.ObservedTimestamp
+		if out, ok := s.takeAccumulated(); ok {
+			flushed = append(flushed, out)
+		}
+		if out, ok := s.takeBucket(t.alignment); ok {
+			aligned = append(aligned, out)
+		}
 		s.Unlock()
-		if lastObserved < staleBefore {
-			t.logger.Debug("removing stale state key", zap.String("key", key.(string)))
+		return true
+	})
+
+	if len(flushed) > 0 {
+		t.flushFunc(flushed)
+	}
+	if len(aligned) > 0 {
+		t.alignFunc(aligned)
+	}
+}
+
+// sweep walks all states, removing those which were last seen more than
+// maxStale ago and emitting heartbeats for those which were not seen
+// during the last heartbeat interval.
+func (t *metricTracker) sweep(currentTime time.Time) {
+	now := pdata.TimestampFromTime(currentTime)
+	var staleBefore, quietBefore, beatBefore pdata.Timestamp
+	if t.maxStale > 0 {
+		staleBefore = pdata.TimestampFromTime(currentTime.Add(-t.maxStale))
+	}
+	if t.heartbeatInterval > 0 {
+		quietBefore = pdata.TimestampFromTime(currentTime.Add(-t.heartbeatInterval))
+		// Sweeps may tick slightly early, allow half a sweep of slack
+		// before the next heartbeat of a series is due.
+		beatBefore = pdata.TimestampFromTime(currentTime.Add(t.sweepInterval/2 - t.heartbeatInterval))
+	}
+
+	var heartbeats, flushed, aligned []DeltaPoint
+	t.states.Range(func(key, value interface{}) bool {
+		s := value.(*State)
+
+		// Staleness is decided and the state removed under its lock.
+		// An update racing with the removal either wins, and the state
+		// is no longer stale, or finds the state marked as removed and
+		// retries against a new state.
+		s.Lock()
+		lastSeen := t.lastSeen(s)
+		stale := lastSeen < staleBefore
+		if stale {
+			// Deltas still awaiting a flush are not lost with the state
+			if out, ok := s.takeAccumulated(); ok {
+				flushed = append(flushed, out)
+			}
+			if out, ok := s.takeBucket(t.alignment); ok {
+				aligned = append(aligned, out)
+			}
+			s.removed = true
 			t.states.Delete(key)
+		} else if sourceNow := t.sourceTime(s, now); lastSeen < quietBefore && s.LastHeartbeat < t.sourceTime(s, beatBefore) &&
+			s.Accumulated == nil && s.PrevPoint.ObservedTimestamp < sourceNow {
+			heartbeats = append(heartbeats, s.heartbeat(sourceNow))
+		}
+		s.Unlock()
+		if stale {
+			if ce := t.logger.Check(zapcore.DebugLevel, "removing stale state"); ce != nil {
+				ce.Write(identityFields(s.Identity)...)
+			}
 		}
 		return true
 	})
+
+	if t.maxStale > 0 {
+		t.sweepTemporalities(staleBefore)
+		t.sweepStarts(staleBefore)
+	}
+
+	if len(heartbeats) > 0 {
+		t.heartbeatFunc(heartbeats)
+	}
+	if len(flushed) > 0 {
+		t.flushFunc(flushed)
+	}
+	if len(aligned) > 0 {
+		t.alignFunc(aligned)
+	}
+}
+
+func (t *metricTracker) sweeper(ctx context.Context, sweep func(time.Time)) {
+	ticker := t.clock.NewTicker(t.sweepInterval)
+	for {
+		select {
+		case currentTime := <-ticker.C():
+			sweep(currentTime)
+		case <-ctx.Done():
+			ticker.Stop()
+			return
+		}
+	}
 }
 
-func (t *metricTracker) sweeper(ctx context.Context, remove func(pdata.Timestamp)) {
-	ticker := time.NewTicker(t.maxStale)
+func (t *metricTracker) flusher(ctx context.Context, flush func()) {
+	ticker := t.clock.NewTicker(t.flushInterval)
 	for {
 		select {
-		case currentTime := <-ticker.C:
-			staleBefore := pdata.TimestampFromTime(currentTime.Add(-t.maxStale))
-			remove(staleBefore)
+		case <-ticker.C():
+			flush()
 		case <-ctx.Done():
 			ticker.Stop()
 			return
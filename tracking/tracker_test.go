@@ -16,7 +16,11 @@ package tracking
 
 import (
 	"context"
+	"math"
 	"reflect"
+	"runtime"
+	"strconv"
+	"sync"
 	"testing"
 	"time"
 
@@ -24,19 +28,24 @@ import (
 	"go.uber.org/zap"
 )
 
-func TestMetricTracker_Convert(t *testing.T) {
-	miSum := MetricIdentity{
+// newSumIdentity returns the identity of a sum series named m.
+func newSumIdentity(monotonic bool, valueType pdata.MetricValueType) MetricIdentity {
+	return MetricIdentity{
 		Resource:               pdata.NewResource(),
 		InstrumentationLibrary: pdata.NewInstrumentationLibrary(),
 		MetricDataType:         pdata.MetricDataTypeSum,
-		MetricIsMonotonic:      true,
-		MetricName:             "",
-		MetricUnit:             "",
+		MetricIsMonotonic:      monotonic,
+		MetricName:             "m",
 		Attributes:             pdata.NewAttributeMap(),
+		MetricValueType:        valueType,
 	}
+}
+
+func TestMetricTracker_Convert(t *testing.T) {
+	miSum := newSumIdentity(true, pdata.MetricValueTypeDouble)
+	miSum.StartTimestamp = 5
 	miIntSum := miSum
 	miIntSum.MetricValueType = pdata.MetricValueTypeInt
-	miSum.MetricValueType = pdata.MetricValueTypeDouble
 
 	m := NewMetricTracker(context.Background(), zap.NewNop(), 0)
 
@@ -53,7 +62,7 @@ func TestMetricTracker_Convert(t *testing.T) {
 				IntValue:          100,
 			},
 			wantOut: DeltaValue{
-				StartTimestamp: 10,
+				StartTimestamp: 5,
 				FloatValue:     100.0,
 				IntValue:       100,
 			},
@@ -149,28 +158,424 @@ func TestMetricTracker_Convert(t *testing.T) {
 	})
 }
 
-func Test_metricTracker_removeStale(t *testing.T) {
-	currentTime := pdata.Timestamp(100)
+func TestMetricTracker_Wraparound(t *testing.T) {
+	miSum := newSumIdentity(true, pdata.MetricValueTypeDouble)
+	miIntSum := miSum
+	miIntSum.MetricValueType = pdata.MetricValueTypeInt
+
+	tests := []struct {
+		name       string
+		wraparound Wraparound
+		prev       int64
+		value      int64
+		wantInt    int64
+		wantFloat  float64
+	}{
+		{
+			name:       "No wraparound resets",
+			wraparound: WraparoundNone,
+			prev:       math.MaxUint32 - 10,
+			value:      5,
+			wantInt:    5,
+			wantFloat:  5,
+		},
+		{
+			name:       "32 bit wraparound",
+			wraparound: Wraparound32,
+			prev:       math.MaxUint32 - 10,
+			value:      5,
+			wantInt:    16,
+			wantFloat:  16,
+		},
+		{
+			name:       "32 bit implausible wraparound resets",
+			wraparound: Wraparound32,
+			prev:       1000,
+			value:      5,
+			wantInt:    5,
+			wantFloat:  5,
+		},
+		{
+			name:       "32 bit value out of range resets",
+			wraparound: Wraparound32,
+			prev:       math.MaxUint32 + 10,
+			value:      5,
+			wantInt:    5,
+			wantFloat:  5,
+		},
+		{
+			name:       "64 bit implausible wraparound resets",
+			wraparound: Wraparound64,
+			prev:       1000,
+			value:      5,
+			wantInt:    5,
+			wantFloat:  5,
+		},
+		{
+			name:       "64 bit increase across the int64 sign",
+			wraparound: Wraparound64,
+			prev:       math.MaxInt64 - 10,
+			value:      math.MinInt64 + 5,
+			wantInt:    16,
+			wantFloat:  math.MinInt64 + 5,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+			policy := Policy{Wraparound: tt.wraparound}
+			for i, id := range []MetricIdentity{miIntSum, miSum} {
+				m.Convert(MetricPoint{
+					Identity: id,
+					Value:    ValuePoint{ObservedTimestamp: 10, IntValue: tt.prev, FloatValue: float64(tt.prev)},
+					Policy:   policy,
+				})
+				out, valid := m.Convert(MetricPoint{
+					Identity: id,
+					Value:    ValuePoint{ObservedTimestamp: 20, IntValue: tt.value, FloatValue: float64(tt.value)},
+					Policy:   policy,
+				})
+				if !valid {
+					t.Fatalf("MetricTracker.Convert() valid = false")
+				}
+				if i == 0 && out.IntValue != tt.wantInt {
+					t.Errorf("MetricTracker.Convert() int delta = %d, want %d", out.IntValue, tt.wantInt)
+				}
+				if i == 1 && out.FloatValue != tt.wantFloat {
+					t.Errorf("MetricTracker.Convert() float delta = %v, want %v", out.FloatValue, tt.wantFloat)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricTracker_InvalidValues(t *testing.T) {
+	newIdentity := func(monotonic bool, valueType pdata.MetricValueType) MetricIdentity {
+		id := newSumIdentity(monotonic, valueType)
+		id.StartTimestamp = 5
+		return id
+	}
+	type result struct {
+		valid bool
+		delta DeltaValue
+	}
+	tests := []struct {
+		name   string
+		id     MetricIdentity
+		action InvalidAction
+		points []ValuePoint
+		want   []result
+	}{
+		{
+			name:   "Int overflow dropped",
+			id:     newIdentity(false, pdata.MetricValueTypeInt),
+			action: InvalidDrop,
+			points: []ValuePoint{{ObservedTimestamp: 10, IntValue: -10}, {ObservedTimestamp: 20, IntValue: math.MaxInt64}, {ObservedTimestamp: 30, IntValue: math.MaxInt64 - 5}},
+			want:   []result{{}, {}, {true, DeltaValue{StartTimestamp: 20, IntValue: -5}}},
+		},
+		{
+			name:   "Int overflow flagged",
+			id:     newIdentity(false, pdata.MetricValueTypeInt),
+			action: InvalidFlag,
+			points: []ValuePoint{{ObservedTimestamp: 10, IntValue: -10}, {ObservedTimestamp: 20, IntValue: math.MaxInt64}, {ObservedTimestamp: 30, IntValue: math.MaxInt64 - 5}},
+			want: []result{
+				{},
+				{true, DeltaValue{StartTimestamp: 10, IntValue: math.MinInt64 + 9, Flag: FlagOverflow}},
+				{true, DeltaValue{StartTimestamp: 20, IntValue: -5}},
+			},
+		},
+		{
+			name:   "Int overflow resets",
+			id:     newIdentity(true, pdata.MetricValueTypeInt),
+			action: InvalidReset,
+			points: []ValuePoint{{ObservedTimestamp: 10, IntValue: -10}, {ObservedTimestamp: 20, IntValue: math.MaxInt64}, {ObservedTimestamp: 30, IntValue: math.MaxInt64}},
+			want: []result{
+				{true, DeltaValue{StartTimestamp: 5, IntValue: -10}},
+				{true, DeltaValue{StartTimestamp: 10, IntValue: math.MaxInt64}},
+				{true, DeltaValue{StartTimestamp: 20}},
+			},
+		},
+		{
+			name:   "Infinite value dropped",
+			id:     newIdentity(true, pdata.MetricValueTypeDouble),
+			action: InvalidDrop,
+			points: []ValuePoint{{ObservedTimestamp: 10, FloatValue: 1}, {ObservedTimestamp: 20, FloatValue: math.Inf(1)}, {ObservedTimestamp: 30, FloatValue: 3}},
+			want:   []result{{true, DeltaValue{StartTimestamp: 5, FloatValue: 1}}, {}, {true, DeltaValue{StartTimestamp: 10, FloatValue: 2}}},
+		},
+		{
+			name:   "Infinite value flagged",
+			id:     newIdentity(true, pdata.MetricValueTypeDouble),
+			action: InvalidFlag,
+			points: []ValuePoint{{ObservedTimestamp: 10, FloatValue: 1}, {ObservedTimestamp: 20, FloatValue: math.Inf(1)}, {ObservedTimestamp: 30, FloatValue: 3}},
+			want: []result{
+				{true, DeltaValue{StartTimestamp: 5, FloatValue: 1}},
+				{true, DeltaValue{StartTimestamp: 10, FloatValue: math.Inf(1), Flag: FlagNonFinite}},
+				{true, DeltaValue{StartTimestamp: 20, FloatValue: 3, Flag: FlagNonFinite}},
+			},
+		},
+		{
+			name:   "Infinite value resets",
+			id:     newIdentity(true, pdata.MetricValueTypeDouble),
+			action: InvalidReset,
+			points: []ValuePoint{{ObservedTimestamp: 10, FloatValue: 1}, {ObservedTimestamp: 20, FloatValue: math.Inf(1)}, {ObservedTimestamp: 30, FloatValue: 3}},
+			want:   []result{{true, DeltaValue{StartTimestamp: 5, FloatValue: 1}}, {}, {true, DeltaValue{StartTimestamp: 20, FloatValue: 3}}},
+		},
+		{
+			name:   "Out of order point after a reset dropped",
+			id:     newIdentity(true, pdata.MetricValueTypeDouble),
+			action: InvalidReset,
+			points: []ValuePoint{{ObservedTimestamp: 10, FloatValue: 1}, {ObservedTimestamp: 20, FloatValue: math.Inf(1)}, {ObservedTimestamp: 15, FloatValue: 2}, {ObservedTimestamp: 30, FloatValue: 3}},
+			want:   []result{{true, DeltaValue{StartTimestamp: 5, FloatValue: 1}}, {}, {}, {true, DeltaValue{StartTimestamp: 20, FloatValue: 3}}},
+		},
+		{
+			name:   "Infinite first value dropped",
+			id:     newIdentity(true, pdata.MetricValueTypeDouble),
+			action: InvalidDrop,
+			points: []ValuePoint{{ObservedTimestamp: 10, FloatValue: math.Inf(-1)}, {ObservedTimestamp: 20, FloatValue: 2}},
+			want:   []result{{}, {true, DeltaValue{StartTimestamp: 10, FloatValue: 2}}},
+		},
+		{
+			name:   "Float overflow flagged",
+			id:     newIdentity(false, pdata.MetricValueTypeDouble),
+			action: InvalidFlag,
+			points: []ValuePoint{{ObservedTimestamp: 10, FloatValue: -math.MaxFloat64}, {ObservedTimestamp: 20, FloatValue: math.MaxFloat64}},
+			want:   []result{{}, {true, DeltaValue{StartTimestamp: 10, FloatValue: math.Inf(1), Flag: FlagOverflow}}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+			for i, point := range tt.points {
+				out, valid := m.Convert(MetricPoint{Identity: tt.id, Value: point, Policy: Policy{InvalidValues: tt.action}})
+				if valid != tt.want[i].valid {
+					t.Fatalf("MetricTracker.Convert() of point %d valid = %v, want %v", i, valid, tt.want[i].valid)
+				}
+				if valid && !reflect.DeepEqual(out, tt.want[i].delta) {
+					t.Errorf("MetricTracker.Convert() of point %d = %+v, want %+v", i, out, tt.want[i].delta)
+				}
+			}
+		})
+	}
+}
+
+func TestMetricTracker_StartTimestamp(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	trackerStart := time.Unix(0, 50)
+
+	tests := []struct {
+		name         string
+		missingStart MissingStart
+		start        pdata.Timestamp
+		timestamp    pdata.Timestamp
+		wantValid    bool
+		wantStart    pdata.Timestamp
+	}{
+		{
+			name:      "Source start",
+			start:     10,
+			timestamp: 100,
+			wantValid: true,
+			wantStart: 10,
+		},
+		{
+			name:      "Missing start uses the tracker start",
+			timestamp: 100,
+			wantValid: true,
+			wantStart: 50,
+		},
+		{
+			name:      "Start not before the point uses the tracker start",
+			start:     100,
+			timestamp: 100,
+			wantValid: true,
+			wantStart: 50,
+		},
+		{
+			name:      "Point before the tracker start dropped",
+			timestamp: 40,
+		},
+		{
+			name:         "Missing start dropped",
+			missingStart: MissingStartDrop,
+			timestamp:    100,
+		},
+		{
+			name:         "Source start with missing starts dropped",
+			missingStart: MissingStartDrop,
+			start:        10,
+			timestamp:    100,
+			wantValid:    true,
+			wantStart:    10,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr := NewMetricTracker(context.Background(), zap.NewNop(), 0,
+				WithClock(NewManualClock(trackerStart)),
+				WithMissingStart(tt.missingStart))
+			id := id
+			id.StartTimestamp = tt.start
+			out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: tt.timestamp, IntValue: 5}})
+			if valid != tt.wantValid {
+				t.Fatalf("MetricTracker.Convert() valid = %v, want %v", valid, tt.wantValid)
+			}
+			if valid && out.StartTimestamp != tt.wantStart {
+				t.Errorf("MetricTracker.Convert() start = %v, want %v", out.StartTimestamp, tt.wantStart)
+			}
+
+			// A point not after the previous one is dropped
+			for _, ts := range []pdata.Timestamp{tt.timestamp, tt.timestamp - 1} {
+				if out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: ts, IntValue: 7}}); valid {
+					t.Errorf("MetricTracker.Convert() at %v = %v, want dropped", ts, out)
+				}
+			}
+			out, valid = tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: tt.timestamp + 10, IntValue: 8}})
+			if !valid || out.StartTimestamp != tt.timestamp || out.IntValue != 3 {
+				t.Errorf("MetricTracker.Convert() = %v, %v, want a delta of 3 starting at %v", out, valid, tt.timestamp)
+			}
+		})
+	}
+}
+
+func TestMetricTracker_Gap(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 1
+
+	tests := []struct {
+		name      string
+		action    GapAction
+		wantValid bool
+		wantParts int
+	}{
+		{name: "Drop", action: GapDrop},
+		{name: "Emit", action: GapEmit, wantValid: true, wantParts: 1},
+		{name: "Spread", action: GapSpread, wantValid: true, wantParts: 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parts []DeltaPoint
+			tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithGapSpread(func(points []DeltaPoint) {
+				parts = append(parts, points...)
+			}))
+			policy := Policy{MaxGap: 15, GapAction: tt.action}
+			tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 10, IntValue: 100}, Policy: policy})
+			if out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 20, IntValue: 110}, Policy: policy}); !valid || out.IntValue != 10 {
+				t.Fatalf("MetricTracker.Convert() within the maximum gap = %v, %v, want a delta of 10", out, valid)
+			}
+
+			out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 100, IntValue: 171}, Policy: policy})
+			if valid != tt.wantValid {
+				t.Fatalf("MetricTracker.Convert() across the gap valid = %v, want %v", valid, tt.wantValid)
+			}
+			if !valid {
+				if out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 110, IntValue: 175}, Policy: policy}); !valid || out.IntValue != 4 || out.StartTimestamp != 100 {
+					t.Errorf("MetricTracker.Convert() after the gap = %v, %v, want a delta of 4 starting at 100", out, valid)
+				}
+				return
+			}
+
+			// The parts cover the gap without overlapping and add up to the delta
+			parts = append(parts, DeltaPoint{Identity: id, Value: out, Timestamp: 100})
+			if len(parts) != tt.wantParts {
+				t.Fatalf("MetricTracker.Convert() spread the delta into %d parts, want %d", len(parts), tt.wantParts)
+			}
+			start := pdata.Timestamp(20)
+			var sum int64
+			for _, p := range parts {
+				if p.Value.StartTimestamp != start || p.Timestamp <= start {
+					t.Errorf("part %v, want a start at %v", p, start)
+				}
+				if tt.action == GapSpread && p.Timestamp-start > 15 {
+					t.Errorf("part %v covers more than the maximum gap", p)
+				}
+				start = p.Timestamp
+				sum += p.Value.IntValue
+			}
+			if start != 100 || sum != 61 {
+				t.Errorf("parts end at %v and add up to %d, want 100 and 61", start, sum)
+			}
+		})
+	}
+}
+
+func TestMetricTracker_GapSpreadParts(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 1
+
+	tests := []struct {
+		name      string
+		values    []int64
+		wantParts []int64
+		wantFlag  Flag
+	}{
+		{
+			name:      "Remainder split across the first parts",
+			values:    []int64{100, 105},
+			wantParts: []int64{1, 1, 1, 1, 1, 0},
+		},
+		{
+			name:      "Flag kept by every part",
+			values:    []int64{-10, math.MaxInt64},
+			wantParts: []int64{-1537228672809129300, -1537228672809129300, -1537228672809129300, -1537228672809129300, -1537228672809129300, -1537228672809129299},
+			wantFlag:  FlagOverflow,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var parts []DeltaPoint
+			tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithGapSpread(func(points []DeltaPoint) {
+				parts = append(parts, points...)
+			}))
+			policy := Policy{MaxGap: 15, GapAction: GapSpread, InvalidValues: InvalidFlag}
+			tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 10, IntValue: tt.values[0]}, Policy: policy})
+			out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 100, IntValue: tt.values[1]}, Policy: policy})
+			if !valid {
+				t.Fatalf("MetricTracker.Convert() across the gap is invalid")
+			}
+			parts = append(parts, DeltaPoint{Identity: id, Value: out, Timestamp: 100})
+			var values []int64
+			for _, p := range parts {
+				values = append(values, p.Value.IntValue)
+				if p.Value.Flag != tt.wantFlag {
+					t.Errorf("part %v flagged %q, want %q", p, p.Value.Flag, tt.wantFlag)
+				}
+			}
+			if !reflect.DeepEqual(values, tt.wantParts) {
+				t.Errorf("MetricTracker.Convert() spread the delta into %v, want %v", values, tt.wantParts)
+			}
+		})
+	}
+}
+
+func Test_metricTracker_sweep(t *testing.T) {
+	currentTime := time.Unix(0, 1000)
 	freshPoint := ValuePoint{
-		ObservedTimestamp: currentTime,
+		ObservedTimestamp: 900,
 	}
 	stalePoint := ValuePoint{
-		ObservedTimestamp: currentTime - 1,
+		ObservedTimestamp: 899,
+	}
+	recentPoint := ValuePoint{
+		ObservedTimestamp: 960,
 	}
 
 	type fields struct {
-		MaxStale time.Duration
-		States   map[string]*State
+		MaxStale          time.Duration
+		SweepInterval     time.Duration
+		HeartbeatInterval time.Duration
+		StalenessClock    StalenessClock
+		States            map[string]*State
 	}
 	tests := []struct {
-		name    string
-		fields  fields
-		wantOut map[string]*State
+		name           string
+		fields         fields
+		wantOut        map[string]*State
+		wantHeartbeats []DeltaPoint
 	}{
 		{
 			name: "Removes stale entry, leaves fresh entry",
 			fields: fields{
-				MaxStale: 0, // This logic isn't tested here
+				MaxStale: 100,
 				States: map[string]*State{
 					"stale": {
 						PrevPoint: stalePoint,
@@ -186,17 +591,114 @@ func Test_metricTracker_removeStale(t *testing.T) {
 				},
 			},
 		},
+		{
+			name: "Emits heartbeat for quiet entry",
+			fields: fields{
+				MaxStale:          100,
+				HeartbeatInterval: 50,
+				States: map[string]*State{
+					"stale": {
+						PrevPoint: stalePoint,
+					},
+					"quiet": {
+						PrevPoint: freshPoint,
+					},
+					"recent": {
+						PrevPoint: recentPoint,
+					},
+				},
+			},
+			wantOut: map[string]*State{
+				"quiet": {
+					PrevPoint:     freshPoint,
+					LastHeartbeat: 1000,
+				},
+				"recent": {
+					PrevPoint: recentPoint,
+				},
+			},
+			wantHeartbeats: []DeltaPoint{
+				{
+					Value:     DeltaValue{StartTimestamp: 900},
+					Timestamp: 1000,
+				},
+			},
+		},
+		{
+			name: "Emits one heartbeat per heartbeat interval",
+			fields: fields{
+				MaxStale:          100,
+				SweepInterval:     10,
+				HeartbeatInterval: 50,
+				States: map[string]*State{
+					"due": {
+						PrevPoint:     freshPoint,
+						LastHeartbeat: 950,
+					},
+					"beaten": {
+						PrevPoint:     freshPoint,
+						LastHeartbeat: 960,
+					},
+				},
+			},
+			wantOut: map[string]*State{
+				"due": {
+					PrevPoint:     freshPoint,
+					LastHeartbeat: 1000,
+				},
+				"beaten": {
+					PrevPoint:     freshPoint,
+					LastHeartbeat: 960,
+				},
+			},
+			wantHeartbeats: []DeltaPoint{
+				{
+					Value:     DeltaValue{StartTimestamp: 950},
+					Timestamp: 1000,
+				},
+			},
+		},
+		{
+			name: "Uses receive time",
+			fields: fields{
+				MaxStale:       100,
+				StalenessClock: ReceiveTime,
+				States: map[string]*State{
+					"skewed": {
+						PrevPoint:    stalePoint,
+						LastReceived: 950,
+					},
+					"stale": {
+						PrevPoint:    recentPoint,
+						LastReceived: 899,
+					},
+				},
+			},
+			wantOut: map[string]*State{
+				"skewed": {
+					PrevPoint:    stalePoint,
+					LastReceived: 950,
+				},
+			},
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
+			var gotHeartbeats []DeltaPoint
 			tr := &metricTracker{
-				logger:   zap.NewNop(),
-				maxStale: tt.fields.MaxStale,
+				logger:            zap.NewNop(),
+				maxStale:          tt.fields.MaxStale,
+				sweepInterval:     tt.fields.SweepInterval,
+				heartbeatInterval: tt.fields.HeartbeatInterval,
+				stalenessClock:    tt.fields.StalenessClock,
+				heartbeatFunc: func(points []DeltaPoint) {
+					gotHeartbeats = append(gotHeartbeats, points...)
+				},
 			}
 			for k, v := range tt.fields.States {
 				tr.states.Store(k, v)
 			}
-			tr.removeStale(currentTime)
+			tr.sweep(currentTime)
 
 			gotOut := make(map[string]*State)
 			tr.states.Range(func(key, value interface{}) bool {
@@ -205,52 +707,390 @@ func Test_metricTracker_removeStale(t *testing.T) {
 			})
 
 			if !reflect.DeepEqual(gotOut, tt.wantOut) {
-				t.Errorf("MetricTracker.removeStale() = %v, want %v", gotOut, tt.wantOut)
+				t.Errorf("MetricTracker.sweep() = %v, want %v", gotOut, tt.wantOut)
+			}
+			if !reflect.DeepEqual(gotHeartbeats, tt.wantHeartbeats) {
+				t.Errorf("MetricTracker.sweep() heartbeats = %v, want %v", gotHeartbeats, tt.wantHeartbeats)
 			}
 		})
 	}
 }
 
+func TestMetricTracker_HeartbeatStartTimestamp(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0).(*metricTracker)
+	tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 10, IntValue: 5}})
+	tr.states.Range(func(_, value interface{}) bool {
+		value.(*State).heartbeat(20)
+		return true
+	})
+
+	out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 30, IntValue: 8}})
+	if !valid || out.StartTimestamp != 20 || out.IntValue != 3 {
+		t.Errorf("MetricTracker.Convert() after heartbeat = %v, want start 20 and value 3", out)
+	}
+}
+
+func TestMetricTracker_Aggregation(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 5
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var flushed []DeltaPoint
+	tr := NewMetricTracker(ctx, zap.NewNop(), 0, WithAggregation(time.Hour, func(points []DeltaPoint) {
+		flushed = append(flushed, points...)
+	}))
+
+	for _, p := range []ValuePoint{
+		{ObservedTimestamp: 10, IntValue: 100},
+		{ObservedTimestamp: 20, IntValue: 150},
+		{ObservedTimestamp: 30, IntValue: 175},
+	} {
+		if _, valid := tr.Convert(MetricPoint{Identity: id, Value: p}); valid {
+			t.Errorf("MetricTracker.Convert() returned a delta while aggregating")
+		}
+	}
+
+	tr.Flush()
+	want := []DeltaPoint{{Identity: id, Value: DeltaValue{StartTimestamp: 5, IntValue: 175}, Timestamp: 30}}
+	if !reflect.DeepEqual(flushed, want) {
+		t.Errorf("MetricTracker.Flush() = %v, want %v", flushed, want)
+	}
+
+	flushed = nil
+	tr.Flush()
+	if len(flushed) != 0 {
+		t.Errorf("MetricTracker.Flush() without new points = %v, want none", flushed)
+	}
+
+	tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 40, IntValue: 200}})
+	tr.Flush()
+	want = []DeltaPoint{{Identity: id, Value: DeltaValue{StartTimestamp: 30, IntValue: 25}, Timestamp: 40}}
+	if !reflect.DeepEqual(flushed, want) {
+		t.Errorf("MetricTracker.Flush() = %v, want %v", flushed, want)
+	}
+}
+
+func TestMetricTracker_StatesAndRemove(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+	point := ValuePoint{ObservedTimestamp: 10, IntValue: 5}
+	tr.Convert(MetricPoint{Identity: id, Value: point})
+
+	states := tr.States()
+	if len(states) != 1 {
+		t.Fatalf("MetricTracker.States() = %v, want 1 state", states)
+	}
+	if states[0].Identity.MetricName != "m" || states[0].PrevPoint != point {
+		t.Errorf("MetricTracker.States() = %v, want identity %v and point %v", states[0], id, point)
+	}
+
+	if !tr.Remove(states[0].Key) {
+		t.Errorf("MetricTracker.Remove() = false, want true")
+	}
+	if tr.Remove(states[0].Key) {
+		t.Errorf("MetricTracker.Remove() of a removed key = true, want false")
+	}
+	if states := tr.States(); len(states) != 0 {
+		t.Errorf("MetricTracker.States() after Remove = %v, want none", states)
+	}
+}
+
+func TestMetricTracker_Restore(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+
+	tr.Restore(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 10, IntValue: 100}})
+	out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 20, IntValue: 150}})
+	want := DeltaValue{StartTimestamp: 10, IntValue: 50}
+	if !valid || out != want {
+		t.Errorf("MetricTracker.Convert() after Restore = %v, %v, want %v, true", out, valid, want)
+	}
+
+	// Restoring replaces the state of a tracked series
+	tr.Restore(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 30, IntValue: 200}})
+	out, valid = tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 40, IntValue: 210}})
+	want = DeltaValue{StartTimestamp: 30, IntValue: 10}
+	if !valid || out != want {
+		t.Errorf("MetricTracker.Convert() after second Restore = %v, %v, want %v, true", out, valid, want)
+	}
+	if states := tr.States(); len(states) != 1 {
+		t.Errorf("MetricTracker.States() = %v, want 1 state", states)
+	}
+}
+
+// TestMetricTracker_ConcurrentRemoval converts points while stale state is
+// removed concurrently. Run it with -race. All points but the last of each
+// series are stale, so state is removed constantly, but the last point must
+// never be lost to a concurrent removal.
+func TestMetricTracker_ConcurrentRemoval(t *testing.T) {
+	const (
+		rounds  = 50
+		series  = 8
+		points  = 100
+		staleAt = pdata.Timestamp(1 << 40)
+	)
+	sweepTime := staleAt.AsTime().Add(1)
+
+	for round := 0; round < rounds; round++ {
+		tr := &metricTracker{
+			logger:   zap.NewNop(),
+			maxStale: 1,
+		}
+
+		done := make(chan struct{})
+		swept := make(chan struct{})
+		go func() {
+			defer close(swept)
+			for {
+				select {
+				case <-done:
+					return
+				default:
+					tr.sweep(sweepTime)
+				}
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < series; i++ {
+			id := newSumIdentity(true, pdata.MetricValueTypeInt)
+			id.MetricName = strconv.Itoa(i)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := int64(1); j <= points; j++ {
+					ts := pdata.Timestamp(j)
+					if j == points {
+						ts = staleAt + 1
+					}
+					out, valid := tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: ts, IntValue: j}})
+					// Either a continuation of the previous point or a new series
+					if !valid || (out.IntValue != 1 && out.IntValue != j) {
+						t.Errorf("MetricTracker.Convert(%v) = %v, %v", j, out, valid)
+					}
+				}
+			}()
+		}
+		wg.Wait()
+		close(done)
+		<-swept
+
+		states := tr.States()
+		if len(states) != series {
+			t.Fatalf("round %d: MetricTracker.States() has %d series, want %d", round, len(states), series)
+		}
+		for _, state := range states {
+			if state.PrevPoint.IntValue != points {
+				t.Fatalf("round %d: series %v lost an update: previous value = %v, want %v", round, state.Identity.MetricName, state.PrevPoint.IntValue, points)
+			}
+		}
+	}
+}
+
+func TestMetricTracker_ReceiveTime(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	clock := NewManualClock(time.Unix(1000, 0))
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithClock(clock), WithStalenessClock(ReceiveTime))
+
+	// The source clock is far behind
+	tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 10, IntValue: 5}})
+	clock.Advance(time.Second)
+	tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 20, IntValue: 6}})
+
+	states := tr.States()
+	if len(states) != 1 {
+		t.Fatalf("MetricTracker.States() = %v, want 1 state", states)
+	}
+	if want := pdata.TimestampFromTime(time.Unix(1001, 0)); states[0].LastSeen != want {
+		t.Errorf("MetricTracker.States() last seen = %v, want %v", states[0].LastSeen, want)
+	}
+}
+
 func Test_metricTracker_sweeper(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
-	sweepEvent := make(chan pdata.Timestamp)
-	closed := false
+	clock := NewManualClock(time.Unix(0, 0))
+	sweepEvent := make(chan time.Time, 2)
+	stopped := make(chan struct{})
 
-	onSweep := func(staleBefore pdata.Timestamp) {
-		sweepEvent <- staleBefore
+	onSweep := func(currentTime time.Time) {
+		sweepEvent <- currentTime
 	}
 
 	tr := &metricTracker{
-		logger:   zap.NewNop(),
-		maxStale: 1 * time.Millisecond,
+		logger:        zap.NewNop(),
+		clock:         clock,
+		maxStale:      time.Minute,
+		sweepInterval: time.Second,
 	}
 
-	start := time.Now()
 	go func() {
 		tr.sweeper(ctx, onSweep)
-		closed = true
-		close(sweepEvent)
+		close(stopped)
 	}()
+	clock.BlockUntil(1)
 
-	for i := 1; i <= 2; i++ {
-		staleBefore := <-sweepEvent
-		tickTime := time.Since(start) + tr.maxStale*time.Duration(i)
-		if closed {
-			t.Fatalf("Sweeper returned prematurely.")
-		}
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case currentTime := <-sweepEvent:
+		t.Fatalf("Sweeper ticked early at %v", currentTime)
+	default:
+	}
 
-		if tickTime < tr.maxStale {
-			t.Errorf("Sweeper tick time is too fast. (%v, want %v)", tickTime, tr.maxStale)
-		}
+	clock.Advance(500 * time.Millisecond)
+	if currentTime := <-sweepEvent; !currentTime.Equal(time.Unix(1, 0)) {
+		t.Errorf("Sweeper ticked at %v, want %v", currentTime, time.Unix(1, 0))
+	}
 
-		staleTime := staleBefore.AsTime()
-		if time.Since(staleTime) < tr.maxStale {
-			t.Errorf("Sweeper called with invalid staleBefore value = %v", staleTime)
+	clock.Advance(2 * time.Second)
+	for _, want := range []time.Time{time.Unix(2, 0), time.Unix(3, 0)} {
+		if currentTime := <-sweepEvent; !currentTime.Equal(want) {
+			t.Errorf("Sweeper ticked at %v, want %v", currentTime, want)
 		}
 	}
+
 	cancel()
-	<-sweepEvent
-	if !closed {
-		t.Errorf("Sweeper did not terminate.")
+	<-stopped
+}
+
+// BenchmarkMetricTracker_StateMemory reports the heap retained per tracked
+// series once the batches the series were first seen in are released.
+func BenchmarkMetricTracker_StateMemory(b *testing.B) {
+	// Points of other series sharing each batch, which must not be retained
+	const batchPoints = 100
+
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0)
+	convert := func(i int) {
+		md := pdata.NewMetrics()
+		rm := md.ResourceMetrics().AppendEmpty()
+		rm.Resource().Attributes().InsertString("service.name", "bench")
+		ilm := rm.InstrumentationLibraryMetrics().AppendEmpty()
+		ilm.InstrumentationLibrary().SetName("bench")
+		m := ilm.Metrics().AppendEmpty()
+		m.SetName("requests")
+		m.SetDataType(pdata.MetricDataTypeSum)
+		m.Sum().SetIsMonotonic(true)
+		m.Sum().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+		for j := 0; j < batchPoints; j++ {
+			dp := m.Sum().DataPoints().AppendEmpty()
+			dp.Attributes().InsertInt("series", int64(i))
+			dp.Attributes().InsertInt("point", int64(j))
+			dp.SetStartTimestamp(1)
+			dp.SetTimestamp(pdata.Timestamp(i + 2))
+			dp.SetIntVal(int64(j))
+		}
+
+		dp := m.Sum().DataPoints().At(0)
+		tr.Convert(MetricPoint{
+			Identity: MetricIdentity{
+				Resource:               rm.Resource(),
+				InstrumentationLibrary: ilm.InstrumentationLibrary(),
+				MetricDataType:         m.DataType(),
+				MetricIsMonotonic:      true,
+				MetricName:             m.Name(),
+				StartTimestamp:         dp.StartTimestamp(),
+				Attributes:             dp.Attributes(),
+				MetricValueType:        dp.Type(),
+			},
+			Value: ValuePoint{
+				ObservedTimestamp: dp.Timestamp(),
+				IntValue:          dp.IntVal(),
+			},
+		})
 	}
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		convert(i)
+	}
+	b.StopTimer()
+	runtime.GC()
+	runtime.ReadMemStats(&after)
+	runtime.KeepAlive(tr)
+
+	b.ReportMetric(float64(int64(after.HeapAlloc)-int64(before.HeapAlloc))/float64(b.N), "heap-B/series")
+}
+
+func TestMetricTracker_Clock(t *testing.T) {
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	start := time.Unix(1000, 0)
+
+	t.Run("heartbeats and eviction", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clock := NewManualClock(start)
+		heartbeats := make(chan DeltaPoint, 10)
+		tr := NewMetricTracker(ctx, zap.NewNop(), time.Minute,
+			WithClock(clock),
+			WithStalenessClock(ReceiveTime),
+			WithHeartbeat(10*time.Second, func(points []DeltaPoint) {
+				for _, p := range points {
+					heartbeats <- p
+				}
+			}))
+		clock.BlockUntil(1)
+		tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 1, IntValue: 5}})
+
+		// Heartbeats from the first sweep the series was quiet for a whole
+		// interval, until it is evicted at 1070s.
+		clock.Advance(70 * time.Second)
+		// Wait for the sweep at 1070s to complete
+		clock.Advance(10 * time.Second)
+
+		// Heartbeats are in the clock of the source, like the point, and
+		// cover the time since the previous one
+		close(heartbeats)
+		var got []pdata.Timestamp
+		prev := pdata.Timestamp(1)
+		for p := range heartbeats {
+			got = append(got, p.Timestamp)
+			if p.Value.StartTimestamp != prev {
+				t.Errorf("heartbeat %v, want a start at %v", p, prev)
+			}
+			prev = p.Timestamp
+		}
+		var want []pdata.Timestamp
+		for s := 20; s <= 60; s += 10 {
+			want = append(want, 1+pdata.Timestamp(time.Duration(s)*time.Second))
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("heartbeats at %v, want %v", got, want)
+		}
+		if states := tr.States(); len(states) != 0 {
+			t.Errorf("MetricTracker.States() = %v, want stale state evicted", states)
+		}
+	})
+
+	t.Run("flush", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		clock := NewManualClock(start)
+		flushed := make(chan []DeltaPoint, 1)
+		tr := NewMetricTracker(ctx, zap.NewNop(), 0,
+			WithClock(clock),
+			WithAggregation(time.Minute, func(points []DeltaPoint) {
+				flushed <- points
+			}))
+		clock.BlockUntil(1)
+		id := id
+		id.StartTimestamp = 5
+		tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 10, IntValue: 5}})
+		tr.Convert(MetricPoint{Identity: id, Value: ValuePoint{ObservedTimestamp: 20, IntValue: 7}})
+
+		clock.Advance(30 * time.Second)
+		select {
+		case points := <-flushed:
+			t.Fatalf("flushed early: %v", points)
+		default:
+		}
+
+		clock.Advance(30 * time.Second)
+		points := <-flushed
+		if len(points) != 1 || points[0].Value.IntValue != 7 || points[0].Value.StartTimestamp != 5 {
+			t.Errorf("flushed %v, want one delta of 7 starting at 5", points)
+		}
+	})
 }
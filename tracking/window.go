@@ -0,0 +1,317 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+// Windows divides time into the consecutive windows deltas are added up
+// over.
+type Windows interface {
+	// Window returns the window containing t, which starts at or before t
+	// and ends after it.
+	Window(t time.Time) (start, end time.Time)
+}
+
+// WithWindows adds up the deltas of each series over the windows of w.
+// Convert returns the total of the window the point falls in so far,
+// starting at the start of the window, instead of the delta. A window
+// holds the points after its start up to its end, so that a point at the
+// end of a window closes it. The final totals of windows closed by a delta
+// spanning their end are emitted through fn.
+func WithWindows(w Windows, fn DeltaFunc) Option {
+	return func(t *metricTracker) {
+		t.windows = w
+		t.windowFunc = fn
+	}
+}
+
+// window is the running total of a series over its current window.
+type window struct {
+	start, end pdata.Timestamp
+	total      DeltaValue
+}
+
+// add adds delta, ending at timestamp, to the window containing timestamp
+// and returns the total of the window, with the final totals of the windows
+// it closes. The part of a delta before the window completes the total of
+// the previous window, ending at its end, and the part in the windows
+// between them, if any, is a total of its own. Of the first delta of a
+// series starting before its window, only the part in proportion to the
+// time it covers of the window is added, so that a series started long ago
+// doesn't count in full.
+func (w *window) add(windows Windows, id MetricIdentity, delta DeltaValue, timestamp pdata.Timestamp) (DeltaValue, []DeltaPoint) {
+	var closed []DeltaPoint
+	if w.end == 0 || timestamp > w.end || timestamp <= w.start {
+		prev := *w
+		start, end := windows.Window((timestamp - 1).AsTime())
+		w.start = pdata.TimestampFromTime(start)
+		w.end = pdata.TimestampFromTime(end)
+		w.total = DeltaValue{StartTimestamp: w.start}
+		if prev.end != 0 && prev.end <= w.start {
+			var before DeltaValue
+			if delta.StartTimestamp < prev.end {
+				before, delta = splitDelta(delta, prev.end, timestamp)
+				prev.total.add(before)
+				closed = append(closed, DeltaPoint{Identity: id, Value: prev.total, Timestamp: prev.end})
+			}
+			if delta.StartTimestamp < w.start {
+				before, delta = splitDelta(delta, w.start, timestamp)
+				closed = append(closed, DeltaPoint{Identity: id, Value: before, Timestamp: w.start})
+			}
+		}
+	}
+	if delta.StartTimestamp < w.start && w.start < timestamp {
+		_, delta = splitDelta(delta, w.start, timestamp)
+	}
+	w.total.add(delta)
+	return w.total, closed
+}
+
+// add adds delta to the total v.
+func (v *DeltaValue) add(delta DeltaValue) {
+	v.FloatValue += delta.FloatValue
+	v.IntValue += delta.IntValue
+	if v.Flag == FlagNone {
+		v.Flag = delta.Flag
+	}
+}
+
+// splitDelta splits delta, ending at timestamp, at the time at, in
+// proportion to the time each part covers. The parts add up to delta.
+func splitDelta(delta DeltaValue, at, timestamp pdata.Timestamp) (before, after DeltaValue) {
+	share := float64(at-delta.StartTimestamp) / float64(timestamp-delta.StartTimestamp)
+	before, after = delta, delta
+	before.IntValue = int64(math.Round(float64(delta.IntValue) * share))
+	before.FloatValue = delta.FloatValue * share
+	after.StartTimestamp = at
+	after.IntValue -= before.IntValue
+	after.FloatValue -= before.FloatValue
+	return before, after
+}
+
+// IntervalWindows are windows of a fixed length, aligned to midnight
+// January 1st 1970 in the wall clock time of a location. Daily windows in
+// a location start at its local midnight, for example.
+type IntervalWindows struct {
+	Interval time.Duration
+	Location *time.Location
+}
+
+func (w IntervalWindows) Window(t time.Time) (start, end time.Time) {
+	t = t.In(w.Location)
+	// The wall clock time of t, as if it was in UTC
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	wallStart := wall.Add(-time.Duration(wall.UnixNano() % int64(w.Interval)))
+	if wall.UnixNano() < 0 && wallStart != wall {
+		wallStart = wallStart.Add(-w.Interval)
+	}
+	start = w.local(wallStart)
+	end = w.local(wallStart.Add(w.Interval))
+	// Wall clock times skipped or repeated by daylight saving time changes
+	// can move the edges past t
+	if start.After(t) {
+		start = t
+	}
+	if !end.After(t) {
+		end = t.Add(w.Interval)
+	}
+	return start, end
+}
+
+// local returns the time of the location with the wall clock time of the
+// UTC time wall.
+func (w IntervalWindows) local(wall time.Time) time.Time {
+	return time.Date(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), wall.Nanosecond(), w.Location)
+}
+
+// Fields of a schedule, with the range of their values.
+var scheduleFields = []struct {
+	name     string
+	min, max int
+}{
+	{"minute", 0, 59},
+	{"hour", 0, 23},
+	{"day of month", 1, 31},
+	{"month", 1, 12},
+	{"day of week", 0, 6},
+}
+
+// maxScheduleSearch bounds how far a schedule is searched for its next or
+// previous time, so that a schedule which never matches, such as February
+// 30th, fails instead of searching forever.
+const maxScheduleSearch = 5 * 366 * 24 * time.Hour
+
+// Schedule windows start at the times of a cron schedule, in the wall
+// clock time of a location.
+type Schedule struct {
+	minute, hour, dom, month, dow uint64
+	// Whether the day of month and day of week are restricted. When both
+	// are, either selects a day, as in cron.
+	domRestricted, dowRestricted bool
+	location                     *time.Location
+}
+
+// ParseSchedule parses a cron expression of five fields: minute, hour, day
+// of month, month and day of week, with Sunday as 0. Each field is a comma
+// separated list of `*`, values and ranges such as `1-5`, each optionally
+// followed by a step such as `*/15`.
+func ParseSchedule(expr string, location *time.Location) (*Schedule, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != len(scheduleFields) {
+		return nil, fmt.Errorf("schedule %q has %d fields instead of %d", expr, len(fields), len(scheduleFields))
+	}
+	var sets [5]uint64
+	for i, field := range fields {
+		set, err := parseScheduleField(field, scheduleFields[i].min, scheduleFields[i].max)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s in schedule %q: %w", scheduleFields[i].name, expr, err)
+		}
+		sets[i] = set
+	}
+	s := &Schedule{
+		minute:        sets[0],
+		hour:          sets[1],
+		dom:           sets[2],
+		month:         sets[3],
+		dow:           sets[4],
+		domRestricted: !strings.HasPrefix(fields[2], "*"),
+		dowRestricted: !strings.HasPrefix(fields[4], "*"),
+		location:      location,
+	}
+	// The windows around the epoch tell whether the schedule ever matches
+	if _, ok := s.next(time.Unix(0, 0)); !ok {
+		return nil, fmt.Errorf("schedule %q never matches", expr)
+	}
+	return s, nil
+}
+
+// parseScheduleField returns the set of values of field, with value i
+// stored as bit i.
+func parseScheduleField(field string, min, max int) (uint64, error) {
+	var set uint64
+	for _, part := range strings.Split(field, ",") {
+		values, step := part, 1
+		if i := strings.IndexByte(part, '/'); i >= 0 {
+			var err error
+			values = part[:i]
+			if step, err = strconv.Atoi(part[i+1:]); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part[i+1:])
+			}
+		}
+		first, last := min, max
+		if values != "*" {
+			bounds := strings.SplitN(values, "-", 2)
+			var err error
+			if first, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", bounds[0])
+			}
+			last = first
+			if len(bounds) == 2 {
+				if last, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", bounds[1])
+				}
+			} else if step > 1 {
+				// A value with a step starts a range up to the maximum
+				last = max
+			}
+			if first < min || last > max || first > last {
+				return 0, fmt.Errorf("%q out of range %d-%d", values, min, max)
+			}
+		}
+		for v := first; v <= last; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+	return set, nil
+}
+
+func (s *Schedule) Window(t time.Time) (start, end time.Time) {
+	var ok bool
+	if start, ok = s.previous(t); !ok {
+		start = t
+	}
+	if end, ok = s.next(t); !ok {
+		end = t.Add(maxScheduleSearch)
+	}
+	return start, end
+}
+
+// dayMatches reports whether the schedule selects the day of t.
+func (s *Schedule) dayMatches(t time.Time) bool {
+	dom := s.dom&(1<<uint(t.Day())) != 0
+	dow := s.dow&(1<<uint(t.Weekday())) != 0
+	if s.domRestricted && s.dowRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+// next returns the first time of the schedule after t.
+func (s *Schedule) next(t time.Time) (time.Time, bool) {
+	t = t.In(s.location)
+	limit := t.Add(maxScheduleSearch)
+	t = truncateMinute(t).Add(time.Minute)
+	for t.Before(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, s.location)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, s.location)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, s.location)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// previous returns the last time of the schedule at or before t.
+func (s *Schedule) previous(t time.Time) (time.Time, bool) {
+	t = t.In(s.location)
+	limit := t.Add(-maxScheduleSearch)
+	t = truncateMinute(t)
+	for t.After(limit) {
+		switch {
+		case s.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, s.location).Add(-time.Minute)
+		case !s.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, s.location).Add(-time.Minute)
+		case s.hour&(1<<uint(t.Hour())) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, s.location).Add(-time.Minute)
+		case s.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(-time.Minute)
+		default:
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// truncateMinute returns the start of the wall clock minute of t. Unlike
+// Truncate it also holds for locations whose offset is not whole minutes.
+func truncateMinute(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, t.Location())
+}
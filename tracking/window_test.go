@@ -0,0 +1,178 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracking
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestWindows(t *testing.T) {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal(err)
+	}
+	schedule := func(expr string) Windows {
+		s, err := ParseSchedule(expr, berlin)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name      string
+		windows   Windows
+		t         string
+		wantStart string
+		wantEnd   string
+	}{
+		{
+			name:      "Hourly interval",
+			windows:   IntervalWindows{Interval: time.Hour, Location: time.UTC},
+			t:         "2021-08-10T14:25:00Z",
+			wantStart: "2021-08-10T14:00:00Z",
+			wantEnd:   "2021-08-10T15:00:00Z",
+		},
+		{
+			name:      "Interval at a window start",
+			windows:   IntervalWindows{Interval: 15 * time.Minute, Location: time.UTC},
+			t:         "2021-08-10T14:30:00Z",
+			wantStart: "2021-08-10T14:30:00Z",
+			wantEnd:   "2021-08-10T14:45:00Z",
+		},
+		{
+			name:      "Daily interval in a time zone",
+			windows:   IntervalWindows{Interval: 24 * time.Hour, Location: berlin},
+			t:         "2021-08-10T23:30:00+02:00",
+			wantStart: "2021-08-10T00:00:00+02:00",
+			wantEnd:   "2021-08-11T00:00:00+02:00",
+		},
+		{
+			name:      "Daily interval across daylight saving time",
+			windows:   IntervalWindows{Interval: 24 * time.Hour, Location: berlin},
+			t:         "2021-03-28T12:00:00+02:00",
+			wantStart: "2021-03-28T00:00:00+01:00",
+			wantEnd:   "2021-03-29T00:00:00+02:00",
+		},
+		{
+			name:      "Daily schedule",
+			windows:   schedule("0 0 * * *"),
+			t:         "2021-08-10T23:30:00+02:00",
+			wantStart: "2021-08-10T00:00:00+02:00",
+			wantEnd:   "2021-08-11T00:00:00+02:00",
+		},
+		{
+			name:      "Weekday mornings",
+			windows:   schedule("30 8 * * 1-5"),
+			t:         "2021-08-14T12:00:00+02:00",
+			wantStart: "2021-08-13T08:30:00+02:00",
+			wantEnd:   "2021-08-16T08:30:00+02:00",
+		},
+		{
+			name:      "Monthly schedule",
+			windows:   schedule("0 0 1 * *"),
+			t:         "2021-08-10T12:00:00+02:00",
+			wantStart: "2021-08-01T00:00:00+02:00",
+			wantEnd:   "2021-09-01T00:00:00+02:00",
+		},
+		{
+			name:      "Steps and lists",
+			windows:   schedule("*/20 6,18 * * *"),
+			t:         "2021-08-10T12:00:00+02:00",
+			wantStart: "2021-08-10T06:40:00+02:00",
+			wantEnd:   "2021-08-10T18:00:00+02:00",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts, _ := time.Parse(time.RFC3339, tt.t)
+			wantStart, _ := time.Parse(time.RFC3339, tt.wantStart)
+			wantEnd, _ := time.Parse(time.RFC3339, tt.wantEnd)
+			start, end := tt.windows.Window(ts)
+			if !start.Equal(wantStart) || !end.Equal(wantEnd) {
+				t.Errorf("Window(%v) = %v, %v, want %v, %v", ts, start, end, wantStart, wantEnd)
+			}
+		})
+	}
+}
+
+func TestParseSchedule_Invalid(t *testing.T) {
+	for _, expr := range []string{
+		"0 0 * *",
+		"60 * * * *",
+		"* 5-2 * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"0 0 30 2 *",
+	} {
+		if _, err := ParseSchedule(expr, time.UTC); err == nil {
+			t.Errorf("ParseSchedule(%q) succeeded, want an error", expr)
+		}
+	}
+}
+
+func TestMetricTracker_Windows(t *testing.T) {
+	hour := pdata.Timestamp(time.Hour)
+	var closed []DeltaPoint
+	tr := NewMetricTracker(context.Background(), zap.NewNop(), 0, WithWindows(IntervalWindows{Interval: time.Hour, Location: time.UTC}, func(points []DeltaPoint) {
+		closed = append(closed, points...)
+	}))
+	id := newSumIdentity(true, pdata.MetricValueTypeInt)
+	id.StartTimestamp = 1
+
+	total := func(start, timestamp pdata.Timestamp, value int64) DeltaPoint {
+		return DeltaPoint{Identity: id, Value: DeltaValue{StartTimestamp: start, IntValue: value}, Timestamp: timestamp}
+	}
+	tests := []struct {
+		timestamp  pdata.Timestamp
+		value      int64
+		wantStart  pdata.Timestamp
+		wantTotal  int64
+		wantClosed []DeltaPoint
+	}{
+		{timestamp: hour / 2, value: 10, wantStart: 0, wantTotal: 10},
+		{timestamp: hour * 3 / 4, value: 15, wantStart: 0, wantTotal: 15},
+		// The part in the next window of a delta ending there starts its
+		// total, the rest completes the previous window
+		{timestamp: hour * 5 / 4, value: 23, wantStart: hour, wantTotal: 4, wantClosed: []DeltaPoint{total(0, hour, 19)}},
+		// Counter resets don't reset the total
+		{timestamp: hour * 3 / 2, value: 2, wantStart: hour, wantTotal: 6},
+		// Windows without points get a total of their part of the delta
+		// spanning them
+		{timestamp: hour * 11 / 2, value: 18, wantStart: hour * 5, wantTotal: 2, wantClosed: []DeltaPoint{total(hour, 2*hour, 8), total(2*hour, 5*hour, 12)}},
+		// A point at the end of a window closes it
+		{timestamp: hour * 6, value: 20, wantStart: hour * 5, wantTotal: 4},
+		{timestamp: hour * 13 / 2, value: 22, wantStart: hour * 6, wantTotal: 2},
+	}
+	for i, tt := range tests {
+		closed = nil
+		out, valid := tr.Convert(MetricPoint{
+			Identity: id,
+			Value:    ValuePoint{ObservedTimestamp: tt.timestamp, IntValue: tt.value},
+		})
+		if !valid || out.StartTimestamp != tt.wantStart || out.IntValue != tt.wantTotal {
+			t.Errorf("MetricTracker.Convert() of point %d = %v, %v, want a total of %d starting at %d", i, out, valid, tt.wantTotal, tt.wantStart)
+		}
+		if !reflect.DeepEqual(closed, tt.wantClosed) {
+			t.Errorf("MetricTracker.Convert() of point %d closed %v, want %v", i, closed, tt.wantClosed)
+		}
+	}
+}